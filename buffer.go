@@ -0,0 +1,212 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+)
+
+// BufferConfig defines the limits used to buffer request bodies.
+//
+// Limit is the maximum body size and is applied using LimitBody. Bodies up to
+// Threshold bytes (defaults to 1 MiB) are kept in memory, larger bodies are
+// spilled to a temporary file in TempDir (defaults to os.TempDir).
+type BufferConfig struct {
+	Limit     int64
+	Threshold int64
+	TempDir   string
+}
+
+type bufferKey struct{}
+
+// Buffer will return a middleware that reads the full request body before
+// calling next. The body is replaced with a BufferedBody that may be rewound and
+// read multiple times and can also be retrieved using BufferedBodyOf. Bodies
+// beyond the limit are rejected with a "413 Request Entity Too Large" problem
+// response like in LimitStrict and bodies that cannot be read with "400 Bad
+// Request". Temporary files are removed once next returns. It will panic if
+// the limit is not positive.
+func Buffer(config BufferConfig) func(http.Handler) http.Handler {
+	// check limit
+	if config.Limit <= 0 {
+		panic("serve: buffer limit must be positive")
+	}
+
+	// set default threshold
+	if config.Threshold == 0 {
+		config.Threshold = 1 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// skip if there is no body
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// reject oversized requests
+			if r.ContentLength > config.Limit {
+				writeLimitProblem(w, config.Limit)
+				return
+			}
+
+			// limit body
+			LimitBody(w, r, config.Limit)
+
+			// buffer body
+			body, err := bufferBody(r.Body, config)
+			_ = r.Body.Close()
+			if errors.Is(err, ErrBodyLimitExceeded) {
+				writeLimitProblem(w, config.Limit)
+				return
+			} else if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer body.cleanup()
+
+			// update request
+			r.Body = body
+			r.ContentLength = body.size
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(body.source, 0, body.size)), nil
+			}
+			r = r.WithContext(context.WithValue(r.Context(), bufferKey{}, body))
+
+			// call next
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BufferedBodyOf returns the body buffered by Buffer.
+func BufferedBodyOf(r *http.Request) (*BufferedBody, bool) {
+	body, ok := r.Context().Value(bufferKey{}).(*BufferedBody)
+	return body, ok
+}
+
+// BufferedBody is a fully buffered request body that may be rewound.
+type BufferedBody struct {
+	data   []byte
+	file   *os.File
+	source io.ReaderAt
+	size   int64
+	sum    []byte
+	reader *io.SectionReader
+}
+
+func bufferBody(r io.Reader, config BufferConfig) (*BufferedBody, error) {
+	// prepare hash
+	hash := sha256.New()
+	r = io.TeeReader(r, hash)
+
+	// read into memory up to the threshold
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, config.Threshold+1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// prepare body
+	body := &BufferedBody{
+		size: n,
+	}
+
+	// use memory if below threshold
+	if n <= config.Threshold {
+		body.data = buf.Bytes()
+		body.source = bytes.NewReader(body.data)
+	} else {
+		// create file
+		file, err := os.CreateTemp(config.TempDir, "serve-buffer-")
+		if err != nil {
+			return nil, err
+		}
+		body.file = file
+		body.source = file
+
+		// write buffered and remaining data
+		_, err = file.Write(buf.Bytes())
+		if err == nil {
+			n, err = io.Copy(file, r)
+			body.size += n
+		}
+		if err != nil {
+			body.cleanup()
+			return nil, err
+		}
+	}
+
+	// set sum and reader
+	body.sum = hash.Sum(nil)
+	body.reader = io.NewSectionReader(body.source, 0, body.size)
+
+	return body, nil
+}
+
+// Read will read from the buffered body.
+func (b *BufferedBody) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+// Seek will seek within the buffered body.
+func (b *BufferedBody) Seek(offset int64, whence int) (int64, error) {
+	return b.reader.Seek(offset, whence)
+}
+
+// Rewind will reset the body to read it again from the start.
+func (b *BufferedBody) Rewind() error {
+	_, err := b.reader.Seek(0, io.SeekStart)
+	return err
+}
+
+// Close is a no-op, the body is released once the Buffer middleware returns.
+func (b *BufferedBody) Close() error {
+	return nil
+}
+
+// Size returns the size of the body.
+func (b *BufferedBody) Size() int64 {
+	return b.size
+}
+
+// Sum returns the SHA-256 sum of the body.
+func (b *BufferedBody) Sum() []byte {
+	return b.sum
+}
+
+// Bytes returns the raw body. The body is read from the temporary file if it
+// has been spilled to disk.
+func (b *BufferedBody) Bytes() ([]byte, error) {
+	// return memory
+	if b.file == nil {
+		return b.data, nil
+	}
+
+	// read file
+	data := make([]byte, b.size)
+	_, err := b.file.ReadAt(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Spilled returns whether the body has been spilled to a temporary file.
+func (b *BufferedBody) Spilled() bool {
+	return b.file != nil
+}
+
+func (b *BufferedBody) cleanup() {
+	// remove file
+	if b.file != nil {
+		_ = b.file.Close()
+		_ = os.Remove(b.file.Name())
+	}
+}
@@ -0,0 +1,90 @@
+package serve
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer(t *testing.T) {
+	var files []string
+	handler := Compose(
+		Buffer(BufferConfig{
+			Limit:     100,
+			Threshold: 10,
+			TempDir:   t.TempDir(),
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := BufferedBodyOf(r)
+			if !ok {
+				_, _ = w.Write([]byte("none"))
+				return
+			}
+			assert.Equal(t, body, r.Body)
+			assert.Equal(t, body.Size(), r.ContentLength)
+
+			data1, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.NoError(t, body.Rewind())
+			data2, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, data1, data2)
+
+			raw, err := body.Bytes()
+			assert.NoError(t, err)
+			assert.Equal(t, data1, raw)
+
+			sum := sha256.Sum256(raw)
+			assert.Equal(t, sum[:], body.Sum())
+
+			rc, err := r.GetBody()
+			assert.NoError(t, err)
+			data3, err := io.ReadAll(rc)
+			assert.NoError(t, err)
+			assert.Equal(t, data1, data3)
+
+			if body.Spilled() {
+				files = append(files, body.file.Name())
+			}
+
+			_, _ = w.Write(data1)
+		}),
+	)
+
+	res := Record(nil, handler, "POST", "/", nil, "Hello!")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "Hello!", res.Body.String())
+	assert.Empty(t, files)
+
+	res = Record(nil, handler, "POST", "/", nil, "Hello World!")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "Hello World!", res.Body.String())
+	assert.Len(t, files, 1)
+
+	_, err := os.Stat(files[0])
+	assert.True(t, os.IsNotExist(err))
+
+	res = Record(nil, handler, "POST", "/", nil, strings.Repeat("x", 101))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	assert.Equal(t, "application/problem+json", res.Header().Get("Content-Type"))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 101)))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	res = Record(nil, handler, "GET", "/", nil, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "none", res.Body.String())
+
+	assert.Panics(t, func() {
+		Buffer(BufferConfig{})
+	})
+}
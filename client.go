@@ -0,0 +1,128 @@
+package serve
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPResolver resolves the client IP address of a request. It should return the
+// zero address if the address cannot be determined.
+type IPResolver func(r *http.Request) netip.Addr
+
+// RemoteAddrResolver returns a resolver that uses the remote address of the
+// request.
+func RemoteAddrResolver() IPResolver {
+	return func(r *http.Request) netip.Addr {
+		return ParseIP(r.RemoteAddr)
+	}
+}
+
+// HeaderResolver returns a resolver that uses the single address in the
+// specified header (e.g. "CF-Connecting-IP"). If trusted proxies are provided,
+// the header is only used if the remote address is a trusted proxy.
+func HeaderResolver(name string, trusted []netip.Prefix) IPResolver {
+	// prepare config
+	config := ForwardedConfig{
+		TrustedProxies: trusted,
+	}
+
+	return func(r *http.Request) netip.Addr {
+		// check remote address
+		if !config.trusted(IP(r.RemoteAddr)) {
+			return netip.Addr{}
+		}
+
+		return ParseIP(strings.TrimSpace(r.Header.Get(name)))
+	}
+}
+
+// RealIPResolver returns a resolver that uses the "X-Real-IP" header. See
+// HeaderResolver for details.
+func RealIPResolver(trusted []netip.Prefix) IPResolver {
+	return HeaderResolver("X-Real-IP", trusted)
+}
+
+// ForwardedForResolver returns a resolver that uses the "X-Forwarded-For"
+// header. If trusted proxies are provided, the header is only used if the
+// remote address is a trusted proxy and the client is selected by walking the
+// addresses from right to left and selecting the first untrusted address.
+// Otherwise, the address at the specified index is selected. Negative indexes
+// are counted from the end of the list.
+func ForwardedForResolver(index int, trusted []netip.Prefix) IPResolver {
+	// prepare config
+	config := ForwardedConfig{
+		ForIndex:       index,
+		TrustedProxies: trusted,
+	}
+
+	return func(r *http.Request) netip.Addr {
+		// check remote address
+		if !config.trusted(IP(r.RemoteAddr)) {
+			return netip.Addr{}
+		}
+
+		// get hops
+		var hops []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+
+		// select hop
+		i := config.index(hops)
+		if i < 0 {
+			return netip.Addr{}
+		}
+
+		return ParseIP(hops[i])
+	}
+}
+
+// ChainResolvers returns a resolver that tries the provided resolvers in order
+// and returns the first valid address.
+func ChainResolvers(resolvers ...IPResolver) IPResolver {
+	return func(r *http.Request) netip.Addr {
+		// try resolvers
+		for _, resolver := range resolvers {
+			if addr := resolver(r); addr.IsValid() {
+				return addr
+			}
+		}
+
+		return netip.Addr{}
+	}
+}
+
+// ClientIP returns the client IP address of the request as determined by the
+// provided resolver. The remote address is used if the resolver is absent. The
+// request is not modified and the returned address is normalized by unmapping
+// IPv4-mapped IPv6 addresses and stripping zones. The zero address is returned
+// if the address cannot be determined.
+func ClientIP(r *http.Request, resolver IPResolver) netip.Addr {
+	// set default resolver
+	if resolver == nil {
+		resolver = RemoteAddrResolver()
+	}
+
+	// resolve address
+	addr := resolver(r)
+	if !addr.IsValid() {
+		return netip.Addr{}
+	}
+
+	return normalizeAddr(addr)
+}
+
+// ParseIP parses and normalizes the IP part from an address of the form
+// ip[:port]. The zero address is returned if the address is invalid.
+func ParseIP(addr string) netip.Addr {
+	// parse address
+	ip, err := netip.ParseAddr(strings.Trim(IP(addr), "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return normalizeAddr(ip)
+}
@@ -0,0 +1,101 @@
+package serve
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIP(t *testing.T) {
+	assert.Equal(t, netip.MustParseAddr("1.2.3.4"), ParseIP("1.2.3.4"))
+	assert.Equal(t, netip.MustParseAddr("1.2.3.4"), ParseIP("1.2.3.4:1234"))
+	assert.Equal(t, netip.MustParseAddr("1.2.3.4"), ParseIP("[::ffff:1.2.3.4]:1234"))
+	assert.Equal(t, netip.MustParseAddr("fe80::1"), ParseIP("[fe80::1%eth0]:1234"))
+	assert.Equal(t, netip.MustParseAddr("::1"), ParseIP("[::1]"))
+	assert.Equal(t, netip.Addr{}, ParseIP("foo"))
+	assert.Equal(t, netip.Addr{}, ParseIP(""))
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := MustPrefixes("192.0.2.0/24, 10.0.0.0/8")
+
+	matrix := []struct {
+		resolver IPResolver
+		remote   string
+		headers  map[string]string
+		result   string
+	}{
+		{
+			result: "192.0.2.1",
+		},
+		{
+			resolver: RealIPResolver(nil),
+			headers:  map[string]string{"X-Real-IP": "::ffff:1.2.3.4"},
+			result:   "1.2.3.4",
+		},
+		{
+			resolver: RealIPResolver(trusted),
+			remote:   "6.6.6.6:1234",
+			headers:  map[string]string{"X-Real-IP": "1.2.3.4"},
+			result:   "invalid IP",
+		},
+		{
+			resolver: HeaderResolver("CF-Connecting-IP", trusted),
+			headers:  map[string]string{"CF-Connecting-IP": "fe80::1%eth0"},
+			result:   "fe80::1",
+		},
+		{
+			resolver: ForwardedForResolver(0, nil),
+			headers:  map[string]string{"X-Forwarded-For": "1.2.3.4, 10.0.0.1"},
+			result:   "1.2.3.4",
+		},
+		{
+			resolver: ForwardedForResolver(-1, nil),
+			headers:  map[string]string{"X-Forwarded-For": "1.2.3.4, 10.0.0.1"},
+			result:   "10.0.0.1",
+		},
+		{
+			resolver: ForwardedForResolver(0, trusted),
+			headers:  map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.0.0.1"},
+			result:   "1.2.3.4",
+		},
+		{
+			resolver: ForwardedForResolver(0, trusted),
+			headers:  map[string]string{"X-Forwarded-For": "foo"},
+			result:   "invalid IP",
+		},
+		{
+			resolver: ChainResolvers(
+				RealIPResolver(trusted),
+				ForwardedForResolver(0, trusted),
+				RemoteAddrResolver(),
+			),
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			result:  "1.2.3.4",
+		},
+		{
+			resolver: ChainResolvers(
+				RealIPResolver(trusted),
+				ForwardedForResolver(0, trusted),
+				RemoteAddrResolver(),
+			),
+			result: "192.0.2.1",
+		},
+	}
+
+	for i, item := range matrix {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		if item.remote != "" {
+			req.RemoteAddr = item.remote
+		}
+		for key, value := range item.headers {
+			req.Header.Set(key, value)
+		}
+
+		remote := req.RemoteAddr
+		assert.Equal(t, item.result, ClientIP(req, item.resolver).String(), i)
+		assert.Equal(t, remote, req.RemoteAddr, i)
+	}
+}
@@ -0,0 +1,222 @@
+package serve
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrCompressionRatioExceeded is returned if a decompressed body exceeds the
+// allowed compression ratio.
+var ErrCompressionRatioExceeded = errors.New("compression ratio exceeded")
+
+// DecompressConfig defines the limits applied to decompressed request bodies.
+//
+// Limit is the maximum amount of decompressed bytes and is applied using
+// LimitBody. It must be positive as unlimited decompression would allow small
+// requests to expand into arbitrarily large bodies. Handlers may raise the limit
+// by calling LimitBody again, which also raises a lower limit applied to the
+// compressed body by earlier middleware like Limit.
+//
+// MaxRatio is the maximum ratio of decompressed to compressed bytes (defaults
+// to 100). The ratio is only checked once more than 64 KiB have been
+// decompressed to allow small bodies with a high compression ratio.
+type DecompressConfig struct {
+	Limit    int64
+	MaxRatio int64
+}
+
+// Decompress will return a middleware that transparently decompresses request
+// bodies encoded with "gzip", "deflate", "br" or "zstd". Requests with an
+// unsupported encoding are rejected with "415 Unsupported Media Type" and
+// requests with an invalid encoding with "400 Bad Request". Compressed bytes
+// are still subject to a limit applied to the original body by earlier
+// middleware like Limit. They are counted as the body is decompressed, which
+// means decoders may read slightly beyond that limit before ErrBodyLimitExceeded
+// is returned. If the handler reads beyond a limit or the ratio without
+// writing a response, a "413 Request Entity Too Large" problem response is
+// written automatically. It will panic if the limit is not positive.
+func Decompress(config DecompressConfig) func(http.Handler) http.Handler {
+	// check limit
+	if config.Limit <= 0 {
+		panic("serve: decompress limit must be positive")
+	}
+
+	// set default ratio
+	if config.MaxRatio == 0 {
+		config.MaxRatio = 100
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// get encodings
+			var encodings []string
+			for _, value := range r.Header.Values("Content-Encoding") {
+				for _, encoding := range strings.Split(value, ",") {
+					encoding = strings.ToLower(strings.TrimSpace(encoding))
+					if encoding != "" && encoding != "identity" {
+						encodings = append(encodings, encoding)
+					}
+				}
+			}
+
+			// skip if not encoded
+			if len(encodings) == 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// prepare body
+			body := &decompressBody{
+				original: r.Body,
+				ratio:    config.MaxRatio,
+			}
+			body.counter.reader = r.Body
+
+			// take over original limit to allow handlers to raise it
+			if bl, ok := r.Body.(*BodyLimiter); ok {
+				body.counter.reader = bl.Original
+				body.limit = bl.Limit
+			}
+			var reader io.Reader = &body.counter
+
+			// apply decoders in reverse order
+			for i := len(encodings) - 1; i >= 0; i-- {
+				decoder, err := newDecoder(encodings[i], reader)
+				if errors.Is(err, errUnsupportedEncoding) {
+					body.Close()
+					w.WriteHeader(http.StatusUnsupportedMediaType)
+					return
+				} else if err != nil {
+					body.Close()
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				body.closers = append(body.closers, decoder)
+				reader = decoder
+			}
+			body.reader = reader
+
+			// update request
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+
+			// limit body
+			limitBody(w, r, config.Limit)
+
+			// call next
+			lw := &limitWriter{ResponseWriter: w}
+			next.ServeHTTP(lw, r)
+
+			// skip if a response has been written
+			if lw.written {
+				return
+			}
+
+			// respond if a limit has been exceeded
+			if body.exceeded {
+				writeTooLargeProblem(w, "request body exceeds compression ratio of "+strconv.FormatInt(config.MaxRatio, 10))
+			} else if body.limited {
+				writeLimitProblem(w, body.limit)
+			} else if bl, ok := r.Body.(*BodyLimiter); ok && bl.Exceeded {
+				writeLimitProblem(w, bl.Limit)
+			}
+		})
+	}
+}
+
+var errUnsupportedEncoding = errors.New("unsupported encoding")
+
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(8<<20))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+type decompressBody struct {
+	original io.ReadCloser
+	counter  countingReader
+	reader   io.Reader
+	closers  []io.Closer
+	ratio    int64
+	total    int64
+	exceeded bool
+	limit    int64
+	limited  bool
+}
+
+func (b *decompressBody) Read(p []byte) (int, error) {
+	// fail immediately if a limit has been exceeded
+	if b.exceeded {
+		return 0, ErrCompressionRatioExceeded
+	} else if b.limited {
+		return 0, ErrBodyLimitExceeded
+	}
+
+	// read
+	n, err := b.reader.Read(p)
+	b.total += int64(n)
+
+	// check limit
+	if b.limit > 0 && b.counter.count > b.limit {
+		b.limited = true
+		return 0, ErrBodyLimitExceeded
+	}
+
+	// check ratio
+	if b.total > 64<<10 && b.total > b.ratio*b.counter.count {
+		b.exceeded = true
+		return n, ErrCompressionRatioExceeded
+	}
+
+	return n, err
+}
+
+func (b *decompressBody) raise(limit int64) {
+	// raise limit of compressed bytes if lower
+	if b.limit > 0 && b.limit < limit {
+		b.limit = limit
+	}
+}
+
+func (b *decompressBody) Close() error {
+	// close decoders
+	for _, closer := range b.closers {
+		_ = closer.Close()
+	}
+
+	return b.original.Close()
+}
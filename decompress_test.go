@@ -0,0 +1,200 @@
+package serve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompress(t *testing.T) {
+	handler := Compose(
+		Decompress(DecompressConfig{
+			Limit: 100,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, err := io.ReadAll(r.Body)
+			if err == ErrBodyLimitExceeded {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Empty(t, r.Header.Get("Content-Encoding"))
+			_, _ = w.Write(data)
+		}),
+	)
+
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd", "gzip, br"} {
+		r := Record(nil, handler, "POST", "/", map[string]string{
+			"Content-Encoding": encoding,
+		}, compress(t, encoding, "Hello World!"))
+		assert.Equal(t, http.StatusOK, r.Code, encoding)
+		assert.Equal(t, "Hello World!", r.Body.String(), encoding)
+
+		r = Record(nil, handler, "POST", "/", map[string]string{
+			"Content-Encoding": encoding,
+		}, compress(t, encoding, strings.Repeat("x", 101)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, r.Code, encoding)
+	}
+
+	r := Record(nil, handler, "POST", "/", nil, "Hello World!")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "Hello World!", r.Body.String())
+
+	r = Record(nil, handler, "POST", "/", map[string]string{
+		"Content-Encoding": "compress",
+	}, "Hello World!")
+	assert.Equal(t, http.StatusUnsupportedMediaType, r.Code)
+
+	r = Record(nil, handler, "POST", "/", map[string]string{
+		"Content-Encoding": "gzip",
+	}, "Hello World!")
+	assert.Equal(t, http.StatusBadRequest, r.Code)
+}
+
+func TestDecompressRaiseLimit(t *testing.T) {
+	handler := Compose(
+		Limit(1000),
+		Decompress(DecompressConfig{
+			Limit:    100,
+			MaxRatio: 1000,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			LimitBody(w, r, 1000)
+			data, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			_, _ = w.Write(data)
+		}),
+	)
+
+	r := Record(nil, handler, "POST", "/", map[string]string{
+		"Content-Encoding": "gzip",
+	}, compress(t, "gzip", strings.Repeat("x", 1000)))
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, strings.Repeat("x", 1000), r.Body.String())
+}
+
+func TestDecompressRaiseOriginalLimit(t *testing.T) {
+	var numbers []string
+	for i := 0; i < 1000; i++ {
+		numbers = append(numbers, strconv.Itoa(i*7919))
+	}
+	data := strings.Join(numbers, " ")
+	payload := compress(t, "gzip", data)
+	assert.Greater(t, len(payload), 100)
+
+	handler := Compose(
+		Limit(100),
+		Decompress(DecompressConfig{
+			Limit: 10,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/raise" {
+				LimitBody(w, r, 1<<30)
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return
+			}
+			_, _ = w.Write(body)
+		}),
+	)
+
+	r := Record(nil, handler, "POST", "/", map[string]string{
+		"Content-Encoding": "gzip",
+	}, payload)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, r.Code)
+
+	r = Record(nil, handler, "POST", "/raise", map[string]string{
+		"Content-Encoding": "gzip",
+	}, payload)
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, data, r.Body.String())
+}
+
+func TestDecompressOriginalLimit(t *testing.T) {
+	handler := Compose(
+		Limit(5),
+		Decompress(DecompressConfig{
+			Limit: 100,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := io.ReadAll(r.Body)
+			if err != nil {
+				assert.Equal(t, ErrBodyLimitExceeded, err)
+				return
+			}
+			_, _ = w.Write([]byte("OK"))
+		}),
+	)
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		r := Record(nil, handler, "POST", "/", map[string]string{
+			"Content-Encoding": encoding,
+		}, compress(t, encoding, "Hello World!"))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, r.Code, encoding)
+		assert.Equal(t, "application/problem+json", r.Header().Get("Content-Type"), encoding)
+		assert.Contains(t, r.Body.String(), "limit of 5 bytes", encoding)
+	}
+
+	assert.PanicsWithValue(t, "serve: decompress limit must be positive", func() {
+		Decompress(DecompressConfig{})
+	})
+}
+
+func TestDecompressRatio(t *testing.T) {
+	handler := Compose(
+		Decompress(DecompressConfig{
+			Limit: 100 << 20,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := io.Copy(io.Discard, r.Body)
+			assert.Equal(t, ErrCompressionRatioExceeded, err)
+			_, err = r.Body.Read(make([]byte, 1))
+			assert.Equal(t, ErrCompressionRatioExceeded, err)
+		}),
+	)
+
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(compress(t, encoding, strings.Repeat("x", 10<<20))))
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, encoding)
+		assert.Contains(t, rec.Body.String(), "compression ratio of 100", encoding)
+	}
+}
+
+func compress(t *testing.T, encodings, data string) string {
+	for _, encoding := range strings.Split(encodings, ",") {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch strings.TrimSpace(encoding) {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "br":
+			w = brotli.NewWriter(&buf)
+		case "zstd":
+			var err error
+			w, err = zstd.NewWriter(&buf, zstd.WithEncoderConcurrency(1))
+			assert.NoError(t, err)
+		}
+		_, err := w.Write([]byte(data))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		data = buf.String()
+	}
+
+	return data
+}
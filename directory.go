@@ -1,29 +1,209 @@
 package serve
 
 import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// DirectoryConfig defines additional options for serving a directory.
+type DirectoryConfig struct {
+	// Precompressed enables serving of precompressed ".br" and ".gz" siblings
+	// of files if they are accepted by the client.
+	Precompressed bool
+
+	// Caching enables the setting of "Cache-Control" headers and strong ETags
+	// derived from the file content. Fingerprinted files (e.g. "app.3f2a1b9c.js")
+	// are cached immutable while the index file and fallback responses must be
+	// revalidated.
+	Caching bool
+
+	// CacheRules are checked in order before the default caching rules.
+	CacheRules []CacheRule
+
+	// Listing defines how directories without an index file are handled.
+	Listing DirectoryListing
+
+	// BlockDotFiles enables responding with "Not Found" for files and
+	// directories whose names begin with a dot (e.g. ".env" or ".git").
+	BlockDotFiles bool
+
+	// BlockPatterns are glob patterns of files that are responded with
+	// "Not Found". Patterns that contain a slash are matched against the full
+	// path, others against every path segment.
+	BlockPatterns []string
+
+	// ConfineSymlinks enables treating symlinks that point outside the
+	// directory as not found.
+	ConfineSymlinks bool
+
+	// ContentTypes maps file extensions (e.g. ".wasm") to content types that
+	// override the embedded MIME database.
+	ContentTypes map[string]string
+
+	// MemoryCache enables an in-memory cache of files, their ETags and
+	// precompressed variants up to the specified amount of bytes. The least
+	// recently used files are evicted first.
+	MemoryCache int64
+
+	// MemoryReload defines the interval after which cached files are checked
+	// for changes on disk. If zero, cached files are never reloaded and changes
+	// are only picked up after they have been evicted. Missing files are not
+	// cached and always looked up on disk.
+	MemoryReload time.Duration
+}
+
+// DirectoryListing defines how directories without an index file are handled.
+type DirectoryListing int
+
+// The available directory listings.
+const (
+	// DefaultListing renders the listing of http.FileServer.
+	DefaultListing DirectoryListing = iota
+
+	// NoListing treats directories without an index file as not found.
+	NoListing
+
+	// HTMLListing renders a styled HTML listing.
+	HTMLListing
+
+	// JSONListing renders a JSON listing.
+	JSONListing
+)
+
+// CacheRule defines the "Cache-Control" header for files matching a pattern.
+type CacheRule struct {
+	// The glob pattern as used by path.Match. Patterns that contain a slash are
+	// matched against the full path, others only against the file name.
+	Pattern string
+
+	// The "Cache-Control" header value.
+	Control string
+}
+
+// ImmutableCacheControl is the "Cache-Control" value set for fingerprinted files.
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
 // Directory constructs a handler that serves a directory found at the specified
 // path. It will serve the index file for not found paths.
 func Directory(prefix, directory string) http.Handler {
+	return DirectoryWith(prefix, directory, DirectoryConfig{})
+}
+
+// DirectoryWith constructs a handler like Directory using the provided config.
+func DirectoryWith(prefix, directory string, config DirectoryConfig) http.Handler {
 	// ensure prefix
 	prefix = "/" + strings.Trim(prefix, "/")
 
+	// check patterns
+	for _, rule := range config.CacheRules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			panic(fmt.Sprintf("serve: invalid cache rule pattern %q", rule.Pattern))
+		}
+	}
+	for _, pattern := range config.BlockPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Sprintf("serve: invalid block pattern %q", pattern))
+		}
+	}
+
 	// create dir server
-	dir := http.Dir(directory)
+	dir := &directoryFS{
+		dir:    http.Dir(directory),
+		config: config,
+		types:  map[string]string{},
+	}
+
+	// normalize content types
+	for ext, typ := range config.ContentTypes {
+		dir.types["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = typ
+	}
+
+	// prepare memory cache
+	if config.MemoryCache > 0 {
+		dir.memory = &memoryCache{
+			limit:  config.MemoryCache,
+			reload: config.MemoryReload,
+			list:   list.New(),
+			items:  map[string]*list.Element{},
+		}
+	}
+
+	// resolve root if symlinks are confined
+	if config.ConfineSymlinks {
+		dir.root = resolvePath(directory)
+	}
 
 	// create file server
 	fs := http.FileServer(dir)
 
+	// prepare etags
+	etags := &etagCache{}
+
 	h := func(w http.ResponseWriter, r *http.Request) {
+		// check if file is blocked
+		if dir.blocked(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+
 		// pre-check if file does exist
-		f, err := dir.Open(r.URL.Path)
-		if err != nil {
+		fallback := false
+		if !dir.exists(r.URL.Path) {
 			r.URL.Path = "/"
-		} else if f != nil {
-			_ = f.Close()
+			fallback = true
+		}
+
+		// handle directories without an index file
+		if config.Listing != DefaultListing && dir.listable(r.URL.Path) {
+			switch config.Listing {
+			case HTMLListing, JSONListing:
+				serveListing(w, r, dir, config.Listing)
+			default:
+				http.NotFound(w, r)
+			}
+			return
+		}
+
+		// get name
+		name := fileName(r.URL.Path)
+
+		// set content type
+		if typ := dir.contentType(name); typ != "" {
+			w.Header().Set("Content-Type", typ)
+		}
+
+		// set caching headers
+		if config.Caching {
+			// set cache control
+			if control := cacheControl(config.CacheRules, name, fallback); control != "" {
+				w.Header().Set("Cache-Control", control)
+			}
+
+			// set etag
+			if etag := etags.get(dir, name); etag != "" {
+				w.Header().Set("ETag", etag)
+			}
+		}
+
+		// serve precompressed file if available
+		if config.Precompressed && servePrecompressed(w, r, dir, name, etags) {
+			return
 		}
 
 		// serve file
@@ -32,3 +212,778 @@ func Directory(prefix, directory string) http.Handler {
 
 	return http.StripPrefix(prefix, http.HandlerFunc(h))
 }
+
+func fileName(upath string) string {
+	// ensure leading slash
+	if !strings.HasPrefix(upath, "/") {
+		upath = "/" + upath
+	}
+
+	// add index file for directories
+	if strings.HasSuffix(upath, "/") {
+		upath += "index.html"
+	}
+
+	return upath
+}
+
+var precompressedEncodings = []struct {
+	name string
+	ext  string
+}{
+	{name: "br", ext: ".br"},
+	{name: "gzip", ext: ".gz"},
+}
+
+func servePrecompressed(w http.ResponseWriter, r *http.Request, dir *directoryFS, name string, etags *etagCache) bool {
+	// requests for the index file are redirected by the file server
+	if strings.HasSuffix(r.URL.Path, "/index.html") {
+		return false
+	}
+
+	// check original file
+	original, err := dir.Open(name)
+	if err != nil {
+		return false
+	}
+	info, err := original.Stat()
+	_ = original.Close()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	// the response will vary by the accepted encodings
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	// parse accepted encodings
+	accepted := parseAcceptEncoding(r.Header.Get("Accept-Encoding"))
+
+	// find the most preferred available encoding
+	var best http.File
+	var bestInfo os.FileInfo
+	var bestName string
+	var bestQuality float64
+	for _, encoding := range precompressedEncodings {
+		// get quality
+		quality, ok := accepted[encoding.name]
+		if !ok {
+			quality = accepted["*"]
+		}
+		if quality <= 0 || quality <= bestQuality {
+			continue
+		}
+
+		// open sibling
+		file, err := dir.Open(name + encoding.ext)
+		if err != nil {
+			continue
+		}
+		stat, err := file.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			_ = file.Close()
+			continue
+		}
+
+		// replace best
+		if best != nil {
+			_ = best.Close()
+		}
+		best = file
+		bestInfo = stat
+		bestName = encoding.name
+		bestQuality = quality
+	}
+	if best == nil {
+		return false
+	}
+
+	// ensure file is closed
+	defer best.Close()
+
+	// ensure content type of original file
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	// set encoding
+	w.Header().Set("Content-Encoding", bestName)
+
+	// set etag of compressed file
+	if dir.config.Caching {
+		w.Header().Del("ETag")
+		if etag := etags.get(dir, name+precompressedExtension(bestName)); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+	}
+
+	// serve content, this will handle range and conditional requests
+	http.ServeContent(w, r, name, bestInfo.ModTime(), best)
+
+	return true
+}
+
+func precompressedExtension(encoding string) string {
+	for _, e := range precompressedEncodings {
+		if e.name == encoding {
+			return e.ext
+		}
+	}
+	return ""
+}
+
+func parseAcceptEncoding(header string) map[string]float64 {
+	// prepare map
+	accepted := map[string]float64{}
+
+	// parse entries
+	for _, entry := range strings.Split(header, ",") {
+		// split parameters
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		} else if name == "x-gzip" {
+			name = "gzip"
+		}
+
+		// parse quality
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(key) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+
+		// set quality
+		accepted[name] = quality
+	}
+
+	return accepted
+}
+
+func cacheControl(rules []CacheRule, name string, fallback bool) string {
+	// check rules
+	for _, rule := range rules {
+		if matchPattern(rule.Pattern, name) {
+			return rule.Control
+		}
+	}
+
+	// index files and fallbacks must always be revalidated
+	if fallback || path.Base(name) == "index.html" {
+		return "no-cache"
+	}
+
+	// fingerprinted files never change
+	if fingerprinted(name) {
+		return ImmutableCacheControl
+	}
+
+	return ""
+}
+
+func matchPattern(pattern, name string) bool {
+	// match full path if pattern contains a slash
+	if strings.Contains(pattern, "/") {
+		ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), strings.TrimPrefix(name, "/"))
+		return ok
+	}
+
+	// otherwise, match file name
+	ok, _ := path.Match(pattern, path.Base(name))
+
+	return ok
+}
+
+func fingerprinted(name string) bool {
+	// get segments, the last segment is the extension
+	segments := strings.FieldsFunc(path.Base(name), func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+	if len(segments) < 2 {
+		return false
+	}
+
+	// check segments
+	for _, segment := range segments[:len(segments)-1] {
+		if isHash(segment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHash(segment string) bool {
+	// check length
+	if len(segment) < 8 {
+		return false
+	}
+
+	// count characters
+	var digit, lower, upper, hexLetter bool
+	for _, c := range segment {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'f':
+			lower = true
+			hexLetter = true
+		case c >= 'g' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c == '_':
+		default:
+			return false
+		}
+	}
+
+	// hex hashes (e.g. webpack) contain digits and letters a-f only
+	onlyHex := !upper && strings.Trim(segment, "0123456789abcdef") == ""
+	if onlyHex {
+		return digit && hexLetter
+	}
+
+	// base64 hashes (e.g. vite) contain digits and mixed case letters, as
+	// mixed case names with digits are common (e.g. "OAuth2Callback"), only
+	// the default length of eight characters is accepted
+	return len(segment) == 8 && digit && lower && upper
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+type etagCache struct {
+	entries sync.Map
+}
+
+func (c *etagCache) get(dir http.FileSystem, name string) string {
+	// open file
+	file, err := dir.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// stat file
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+
+	// use precomputed etag
+	if mf, ok := file.(*memoryFile); ok {
+		return mf.asset.etag
+	}
+
+	// check cache
+	if value, ok := c.entries.Load(name); ok {
+		entry := value.(etagEntry)
+		if entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+			return entry.etag
+		}
+	}
+
+	// hash content
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return ""
+	}
+
+	// compute etag
+	etag := contentETag(hash.Sum(nil))
+
+	// store entry
+	c.entries.Store(name, etagEntry{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		etag:    etag,
+	})
+
+	return etag
+}
+
+func contentETag(sum []byte) string {
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+type directoryFS struct {
+	dir    http.Dir
+	root   string
+	config DirectoryConfig
+	types  map[string]string
+	memory *memoryCache
+}
+
+func (d *directoryFS) Open(name string) (http.File, error) {
+	// check if file is blocked
+	if d.blocked(name) {
+		return nil, os.ErrNotExist
+	}
+
+	// use memory cache if available
+	if d.memory != nil {
+		return d.openCached(path.Clean("/" + name))
+	}
+
+	return d.open(name)
+}
+
+func (d *directoryFS) open(name string) (http.File, error) {
+	// check if file escapes the root
+	if !d.confined(name) {
+		return nil, os.ErrNotExist
+	}
+
+	// open file
+	file, err := d.dir.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &directoryFile{File: file, fs: d, name: name}, nil
+}
+
+func (d *directoryFS) openCached(name string) (http.File, error) {
+	// check cache
+	entry, ok := d.memory.get(name)
+	if ok && !d.memory.stale(entry) {
+		return entry.asset.open(), nil
+	}
+
+	// open file
+	file, err := d.open(name)
+	if os.IsNotExist(err) {
+		d.memory.remove(name)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	// stat file
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// pass through directories and files that do not fit
+	if !info.Mode().IsRegular() || info.Size() > d.memory.limit {
+		d.memory.remove(name)
+		return file, nil
+	}
+
+	// keep unchanged asset
+	if ok && entry.asset.info.ModTime().Equal(info.ModTime()) && entry.asset.info.Size() == info.Size() {
+		_ = file.Close()
+		d.memory.put(name, entry.asset)
+		return entry.asset.open(), nil
+	}
+
+	// read file
+	data, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare asset
+	sum := sha256.Sum256(data)
+	asset := &memoryAsset{
+		data: data,
+		info: info,
+		etag: contentETag(sum[:]),
+	}
+
+	// store asset
+	d.memory.put(name, asset)
+
+	return asset.open(), nil
+}
+
+func (d *directoryFS) exists(name string) bool {
+	// open file
+	file, err := d.Open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// treat directories without an index file as missing if listings are
+	// disabled
+	if d.config.Listing == NoListing {
+		info, err := file.Stat()
+		if err != nil {
+			return false
+		} else if info.IsDir() && d.listable(name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *directoryFS) contentType(name string) string {
+	// check overrides
+	ext := strings.ToLower(path.Ext(name))
+	if typ, ok := d.types[ext]; ok {
+		return typ
+	}
+
+	// check embedded database
+	if typ := lookupMimeType(ext, true); typ != "" {
+		return typ
+	}
+
+	// open file
+	file, err := d.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// check file
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+
+	// otherwise, sniff content
+	var buf [512]byte
+	n, _ := io.ReadFull(file, buf[:])
+
+	return http.DetectContentType(buf[:n])
+}
+
+func (d *directoryFS) listable(name string) bool {
+	// check directory
+	file, err := d.Open(name)
+	if err != nil {
+		return false
+	}
+	info, err := file.Stat()
+	_ = file.Close()
+	if err != nil || !info.IsDir() {
+		return false
+	}
+
+	// check index file
+	index, err := d.Open(path.Join("/", name, "index.html"))
+	if err != nil {
+		return true
+	}
+	_ = index.Close()
+
+	return false
+}
+
+func (d *directoryFS) blocked(name string) bool {
+	// clean name
+	name = path.Clean("/" + name)
+
+	// check segments
+	for _, segment := range strings.Split(name, "/") {
+		// check dot files
+		if d.config.BlockDotFiles && strings.HasPrefix(segment, ".") {
+			return true
+		}
+
+		// check segment patterns
+		for _, pattern := range d.config.BlockPatterns {
+			if !strings.Contains(pattern, "/") && segment != "" && matchPattern(pattern, segment) {
+				return true
+			}
+		}
+	}
+
+	// check path patterns
+	for _, pattern := range d.config.BlockPatterns {
+		if strings.Contains(pattern, "/") && matchPattern(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *directoryFS) confined(name string) bool {
+	// skip if not confined
+	if d.root == "" {
+		return true
+	}
+
+	// resolve symlinks, missing files are left to the file system
+	real, err := filepath.EvalSymlinks(filepath.Join(string(d.dir), filepath.FromSlash(path.Clean("/"+name))))
+	if os.IsNotExist(err) {
+		return true
+	} else if err != nil {
+		return false
+	}
+
+	// check if path is within root
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(d.root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	return true
+}
+
+type directoryFile struct {
+	http.File
+	fs   *directoryFS
+	name string
+}
+
+func (f *directoryFile) Readdir(count int) ([]os.FileInfo, error) {
+	// read entries
+	list, err := f.File.Readdir(count)
+
+	// filter blocked and escaping entries
+	filtered := list[:0]
+	for _, info := range list {
+		name := path.Join("/", f.name, info.Name())
+		if !f.fs.blocked(name) && f.fs.confined(name) {
+			filtered = append(filtered, info)
+		}
+	}
+
+	return filtered, err
+}
+
+func resolvePath(dir string) string {
+	// get absolute path
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+
+	// resolve symlinks
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs
+	}
+
+	return real
+}
+
+type listingEntry struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Modified  time.Time `json:"modified"`
+	Directory bool      `json:"directory"`
+}
+
+var listingTemplate = template.Must(template.New("").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; font-weight: normal; }
+table { border-collapse: collapse; min-width: 50%; }
+th, td { padding: 0.3em 1em 0.3em 0; text-align: left; }
+th { border-bottom: 1px solid #ccc; }
+td.size { text-align: right; }
+a { color: #0366d6; text-decoration: none; }
+a:hover { text-decoration: underline; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{range .Entries}}<tr><td><a href="{{.Name}}{{if .Directory}}/{{end}}">{{.Name}}{{if .Directory}}/{{end}}</a></td><td class="size">{{if not .Directory}}{{.Size}}{{end}}</td><td>{{.Modified.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func serveListing(w http.ResponseWriter, r *http.Request, dir http.FileSystem, listing DirectoryListing) {
+	// redirect to canonical path
+	if !strings.HasSuffix(r.URL.Path, "/") && r.URL.Path != "" {
+		url := path.Base(r.URL.Path) + "/"
+		if r.URL.RawQuery != "" {
+			url += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", url)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	// open directory
+	file, err := dir.Open(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	// read entries
+	list, err := file.Readdir(-1)
+	if err != nil {
+		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+
+	// sort entries
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+
+	// prepare entries
+	entries := make([]listingEntry, 0, len(list))
+	for _, info := range list {
+		entries = append(entries, listingEntry{
+			Name:      info.Name(),
+			Size:      info.Size(),
+			Modified:  info.ModTime(),
+			Directory: info.IsDir(),
+		})
+	}
+
+	// write JSON listing
+	if listing == JSONListing {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	// write HTML listing
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = listingTemplate.Execute(w, map[string]interface{}{
+		"Path":    path.Clean("/" + r.URL.Path),
+		"Entries": entries,
+	})
+}
+
+type memoryAsset struct {
+	data []byte
+	info os.FileInfo
+	etag string
+}
+
+func (a *memoryAsset) open() http.File {
+	return &memoryFile{
+		Reader: bytes.NewReader(a.data),
+		asset:  a,
+	}
+}
+
+type memoryFile struct {
+	*bytes.Reader
+	asset *memoryAsset
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+func (f *memoryFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, errors.New("serve: not a directory")
+}
+
+func (f *memoryFile) Stat() (os.FileInfo, error) {
+	return f.asset.info, nil
+}
+
+type memoryEntry struct {
+	name    string
+	asset   *memoryAsset
+	checked time.Time
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.asset.data))
+}
+
+type memoryCache struct {
+	limit  int64
+	reload time.Duration
+	size   int64
+	list   *list.List
+	items  map[string]*list.Element
+	mutex  sync.Mutex
+}
+
+func (c *memoryCache) get(name string) (*memoryEntry, bool) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// get item
+	item, ok := c.items[name]
+	if !ok {
+		return nil, false
+	}
+
+	// mark as recently used
+	c.list.MoveToFront(item)
+
+	return item.Value.(*memoryEntry), true
+}
+
+func (c *memoryCache) stale(entry *memoryEntry) bool {
+	return c.reload > 0 && time.Since(entry.checked) > c.reload
+}
+
+func (c *memoryCache) put(name string, asset *memoryAsset) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// remove existing item
+	if item, ok := c.items[name]; ok {
+		c.drop(item)
+	}
+
+	// prepare entry
+	entry := &memoryEntry{
+		name:    name,
+		asset:   asset,
+		checked: time.Now(),
+	}
+
+	// add item
+	c.items[name] = c.list.PushFront(entry)
+	c.size += entry.size()
+
+	// evict least recently used items
+	for c.size > c.limit && c.list.Len() > 0 {
+		c.drop(c.list.Back())
+	}
+}
+
+func (c *memoryCache) remove(name string) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// remove item
+	if item, ok := c.items[name]; ok {
+		c.drop(item)
+	}
+}
+
+func (c *memoryCache) drop(item *list.Element) {
+	entry := item.Value.(*memoryEntry)
+	c.size -= entry.size()
+	c.list.Remove(item)
+	delete(c.items, entry.name)
+}
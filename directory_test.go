@@ -1,7 +1,11 @@
 package serve
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -35,3 +39,408 @@ func TestDirectory(t *testing.T) {
 	assert.Equal(t, 200, r.Code)
 	assert.Equal(t, "<h1>Hello</h1>\n", r.Body.String())
 }
+
+func TestDirectoryPrecompressed(t *testing.T) {
+	handler := DirectoryWith("/", ".test/assets/", DirectoryConfig{
+		Precompressed: true,
+	})
+
+	r := Record(nil, handler, "GET", "/app.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "", r.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", r.Header().Get("Vary"))
+	assert.Equal(t, "console.log(\"Hello\");\n", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "gzip, deflate, br",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "br", r.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", r.Header().Get("Vary"))
+	assert.Equal(t, "application/javascript", r.Header().Get("Content-Type"))
+	assert.Equal(t, readFile(t, ".test/assets/app.js.br"), r.Body.String())
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "br;q=0.5, gzip",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "gzip", r.Header().Get("Content-Encoding"))
+	assert.Equal(t, readFile(t, ".test/assets/app.js.gz"), r.Body.String())
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "*, br;q=0",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "gzip", r.Header().Get("Content-Encoding"))
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "gzip",
+		"Range":           "bytes=0-3",
+	}, "")
+	assert.Equal(t, 206, r.Code)
+	assert.Equal(t, "gzip", r.Header().Get("Content-Encoding"))
+	assert.Equal(t, readFile(t, ".test/assets/app.js.gz")[:4], r.Body.String())
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding":   "gzip",
+		"If-Modified-Since": r.Header().Get("Last-Modified"),
+	}, "")
+	assert.Equal(t, 304, r.Code)
+
+	r = Record(nil, handler, "GET", "/", map[string]string{
+		"Accept-Encoding": "gzip, br",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "", r.Header().Get("Content-Encoding"))
+	assert.Equal(t, "<h1>Hello</h1>\n", r.Body.String())
+}
+
+func readFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestDirectoryCaching(t *testing.T) {
+	handler := DirectoryWith("/", ".test/assets/", DirectoryConfig{
+		Precompressed: true,
+		Caching:       true,
+		CacheRules: []CacheRule{
+			{Pattern: "*.js", Control: "public, max-age=60"},
+		},
+	})
+
+	r := Record(nil, handler, "GET", "/", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "no-cache", r.Header().Get("Cache-Control"))
+	assert.Equal(t, `"320a24004f649a98b65535e7c06bd8df"`, r.Header().Get("ETag"))
+
+	r = Record(nil, handler, "GET", "/foo", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "no-cache", r.Header().Get("Cache-Control"))
+	assert.Equal(t, `"320a24004f649a98b65535e7c06bd8df"`, r.Header().Get("ETag"))
+
+	r = Record(nil, handler, "GET", "/", map[string]string{
+		"If-None-Match": `"320a24004f649a98b65535e7c06bd8df"`,
+	}, "")
+	assert.Equal(t, 304, r.Code)
+
+	r = Record(nil, handler, "GET", "/app.3f2a1b9c.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "public, max-age=60", r.Header().Get("Cache-Control"))
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "gzip",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "gzip", r.Header().Get("Content-Encoding"))
+	assert.NotEmpty(t, r.Header().Get("ETag"))
+	etag := r.Header().Get("ETag")
+
+	r = Record(nil, handler, "GET", "/app.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.NotEqual(t, etag, r.Header().Get("ETag"))
+
+	handler = DirectoryWith("/", ".test/assets/", DirectoryConfig{
+		Caching: true,
+	})
+
+	r = Record(nil, handler, "GET", "/app.3f2a1b9c.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, ImmutableCacheControl, r.Header().Get("Cache-Control"))
+
+	r = Record(nil, handler, "GET", "/app.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "", r.Header().Get("Cache-Control"))
+}
+
+func TestFingerprinted(t *testing.T) {
+	matrix := []struct {
+		name string
+		ok   bool
+	}{
+		{name: "app.js", ok: false},
+		{name: "app.3f2a1b9c.js", ok: true},
+		{name: "main.3f2a1b9c.chunk.js", ok: true},
+		{name: "index-BdF3k9aZ.js", ok: true},
+		{name: "bootstrap4.min.css", ok: false},
+		{name: "report-20240101.pdf", ok: false},
+		{name: "deadbeefcafe.png", ok: false},
+		{name: "3f2a1b9c", ok: false},
+		{name: "LoginPage2.js", ok: false},
+		{name: "Button2Primary.js", ok: false},
+		{name: "OAuth2Callback.js", ok: false},
+		{name: "iPhone12Pro.png", ok: false},
+	}
+
+	for _, item := range matrix {
+		assert.Equal(t, item.ok, fingerprinted("/assets/"+item.name), item.name)
+	}
+}
+
+func TestDirectoryProtection(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(dir, "index.html"), "<h1>Hello</h1>\n")
+	writeFile(t, filepath.Join(dir, ".env"), "SECRET=1")
+	writeFile(t, filepath.Join(dir, ".git", "config"), "[core]")
+	writeFile(t, filepath.Join(dir, "app.js.map"), "{}")
+	writeFile(t, filepath.Join(dir, "private", "data.txt"), "data")
+	writeFile(t, filepath.Join(dir, "app.js"), "app")
+	writeFile(t, filepath.Join(outside, "secret.txt"), "secret")
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "secret.txt")))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "app.js"), filepath.Join(dir, "link.js")))
+
+	handler := Directory("/", dir)
+
+	r := Record(nil, handler, "GET", "/.env", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "SECRET=1", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/secret.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "secret", r.Body.String())
+
+	handler = DirectoryWith("/", dir, DirectoryConfig{
+		BlockDotFiles:   true,
+		BlockPatterns:   []string{"*.map", "private/*"},
+		ConfineSymlinks: true,
+	})
+
+	r = Record(nil, handler, "GET", "/.env", nil, "")
+	assert.Equal(t, 404, r.Code)
+
+	r = Record(nil, handler, "GET", "/.git/config", nil, "")
+	assert.Equal(t, 404, r.Code)
+
+	r = Record(nil, handler, "GET", "/app.js.map", nil, "")
+	assert.Equal(t, 404, r.Code)
+
+	r = Record(nil, handler, "GET", "/private/data.txt", nil, "")
+	assert.Equal(t, 404, r.Code)
+
+	r = Record(nil, handler, "GET", "/secret.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "<h1>Hello</h1>\n", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/link.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "app", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/app.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "app", r.Body.String())
+}
+
+func TestDirectoryListing(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "index.html"), "<h1>Hello</h1>\n")
+	writeFile(t, filepath.Join(dir, "docs", "b.txt"), "b")
+	writeFile(t, filepath.Join(dir, "docs", "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "docs", ".hidden"), "hidden")
+	writeFile(t, filepath.Join(dir, "docs", "sub", "c.txt"), "c")
+
+	handler := Directory("/", dir)
+
+	r := Record(nil, handler, "GET", "/docs/", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Contains(t, r.Body.String(), `<a href="a.txt">a.txt</a>`)
+
+	handler = DirectoryWith("/", dir, DirectoryConfig{
+		Listing: NoListing,
+	})
+
+	r = Record(nil, handler, "GET", "/docs/", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "<h1>Hello</h1>\n", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/docs/a.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "a", r.Body.String())
+
+	handler = DirectoryWith("/", filepath.Join(dir, "docs"), DirectoryConfig{
+		Listing: NoListing,
+	})
+
+	r = Record(nil, handler, "GET", "/", nil, "")
+	assert.Equal(t, 404, r.Code)
+
+	r = Record(nil, handler, "GET", "/foo", nil, "")
+	assert.Equal(t, 404, r.Code)
+
+	handler = DirectoryWith("/", dir, DirectoryConfig{
+		Listing:       JSONListing,
+		BlockDotFiles: true,
+	})
+
+	r = Record(nil, handler, "GET", "/docs", nil, "")
+	assert.Equal(t, 301, r.Code)
+	assert.Equal(t, "docs/", r.Header().Get("Location"))
+
+	r = Record(nil, handler, "GET", "/docs/", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "application/json; charset=utf-8", r.Header().Get("Content-Type"))
+
+	var entries []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &entries))
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "a.txt", entries[0]["name"])
+	assert.Equal(t, float64(1), entries[0]["size"])
+	assert.Equal(t, false, entries[0]["directory"])
+	assert.Equal(t, "b.txt", entries[1]["name"])
+	assert.Equal(t, "sub", entries[2]["name"])
+	assert.Equal(t, true, entries[2]["directory"])
+
+	handler = DirectoryWith("/", dir, DirectoryConfig{
+		Listing: HTMLListing,
+	})
+
+	r = Record(nil, handler, "GET", "/docs/", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "text/html; charset=utf-8", r.Header().Get("Content-Type"))
+	assert.Contains(t, r.Body.String(), "<title>Index of /docs</title>")
+	assert.Contains(t, r.Body.String(), `<a href="sub/">sub/</a>`)
+	assert.Contains(t, r.Body.String(), `<a href=".hidden">.hidden</a>`)
+}
+
+func writeFile(t *testing.T, name, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+	assert.NoError(t, os.WriteFile(name, []byte(content), 0644))
+}
+
+func TestDirectoryContentTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "index.html"), "<h1>Hello</h1>\n")
+	writeFile(t, filepath.Join(dir, "app.js"), "app")
+	writeFile(t, filepath.Join(dir, "style.css"), "body {}")
+	writeFile(t, filepath.Join(dir, "data.unknown"), "Hello World!")
+	writeFile(t, filepath.Join(dir, "module.wasm"), "\x00asm")
+	writeFile(t, filepath.Join(dir, "schema.custom"), "{}")
+
+	handler := DirectoryWith("/", dir, DirectoryConfig{
+		ContentTypes: map[string]string{
+			"custom": "application/schema+json",
+			".JS":    "text/javascript; charset=utf-8",
+		},
+	})
+
+	matrix := []struct {
+		path string
+		typ  string
+	}{
+		{path: "/", typ: "text/html; charset=utf-8"},
+		{path: "/foo", typ: "text/html; charset=utf-8"},
+		{path: "/app.js", typ: "text/javascript; charset=utf-8"},
+		{path: "/style.css", typ: "text/css; charset=utf-8"},
+		{path: "/data.unknown", typ: "text/plain; charset=utf-8"},
+		{path: "/module.wasm", typ: "application/wasm"},
+		{path: "/schema.custom", typ: "application/schema+json"},
+	}
+
+	for _, item := range matrix {
+		r := Record(nil, handler, "GET", item.path, nil, "")
+		assert.Equal(t, 200, r.Code, item.path)
+		assert.Equal(t, item.typ, r.Header().Get("Content-Type"), item.path)
+	}
+}
+
+func TestDirectoryMemoryCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "index.html"), "<h1>Hello</h1>\n")
+	writeFile(t, filepath.Join(dir, "a.txt"), "aaaaaaaaaa")
+	writeFile(t, filepath.Join(dir, "b.txt"), "bbbbbbbbbb")
+
+	handler := DirectoryWith("/", dir, DirectoryConfig{
+		Caching:     true,
+		MemoryCache: 15,
+	})
+
+	r := Record(nil, handler, "GET", "/a.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "aaaaaaaaaa", r.Body.String())
+	assert.NotEmpty(t, r.Header().Get("ETag"))
+	etag := r.Header().Get("ETag")
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "a.txt")))
+
+	r = Record(nil, handler, "GET", "/a.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "aaaaaaaaaa", r.Body.String())
+	assert.Equal(t, etag, r.Header().Get("ETag"))
+
+	r = Record(nil, handler, "GET", "/a.txt", map[string]string{
+		"If-None-Match": etag,
+	}, "")
+	assert.Equal(t, 304, r.Code)
+
+	r = Record(nil, handler, "GET", "/a.txt", map[string]string{
+		"Range": "bytes=2-4",
+	}, "")
+	assert.Equal(t, 206, r.Code)
+	assert.Equal(t, "aaa", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/b.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "bbbbbbbbbb", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/a.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "<h1>Hello</h1>\n", r.Body.String())
+
+	handler = DirectoryWith("/", dir, DirectoryConfig{
+		MemoryCache: MustByteSize("1M"),
+	})
+
+	r = Record(nil, handler, "GET", "/c.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "<h1>Hello</h1>\n", r.Body.String())
+
+	writeFile(t, filepath.Join(dir, "c.txt"), "cc")
+
+	r = Record(nil, handler, "GET", "/c.txt", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "cc", r.Body.String())
+}
+
+func TestDirectoryMemoryReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "index.html"), "<h1>Hello</h1>\n")
+	writeFile(t, filepath.Join(dir, "app.js"), "v1")
+
+	handler := DirectoryWith("/", dir, DirectoryConfig{
+		Precompressed: true,
+		MemoryCache:   MustByteSize("1M"),
+		MemoryReload:  time.Millisecond,
+	})
+
+	r := Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "gzip",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "v1", r.Body.String())
+
+	writeFile(t, filepath.Join(dir, "app.js"), "v2!")
+	writeFile(t, filepath.Join(dir, "app.js.gz"), "gz")
+	time.Sleep(5 * time.Millisecond)
+
+	r = Record(nil, handler, "GET", "/app.js", nil, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "v2!", r.Body.String())
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "gzip",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "gzip", r.Header().Get("Content-Encoding"))
+	assert.Equal(t, "gz", r.Body.String())
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "app.js.gz")))
+	time.Sleep(5 * time.Millisecond)
+
+	r = Record(nil, handler, "GET", "/app.js", map[string]string{
+		"Accept-Encoding": "gzip",
+	}, "")
+	assert.Equal(t, 200, r.Code)
+	assert.Equal(t, "", r.Header().Get("Content-Encoding"))
+	assert.Equal(t, "v2!", r.Body.String())
+}
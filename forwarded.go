@@ -1,22 +1,69 @@
 package serve
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	"path"
 	"strconv"
 	"strings"
 )
 
-// ForwardedConfig defines handling of "X-Forwarded-X" headers.
+// ForwardedHeaders defines the family of forwarding headers that is trusted.
+type ForwardedHeaders int
+
+// The available forwarding header families.
+const (
+	// XForwarded trusts the de-facto standard "X-Forwarded-For",
+	// "X-Forwarded-Port" and "X-Forwarded-Proto" headers.
+	XForwarded ForwardedHeaders = iota
+
+	// RFC7239 trusts the standardized "Forwarded" header.
+	RFC7239
+)
+
+// ForwardedConfig defines handling of "X-Forwarded-X" and "Forwarded" headers.
+//
+// If UseHost is set, the host is taken from the first "X-Forwarded-Host" value
+// or the "host" parameter of the selected "Forwarded" element. If UsePrefix is
+// set, the external path prefix is taken from the "X-Forwarded-Prefix" header
+// for both header families. Forwarded hosts are validated and only accepted if
+// AllowedHosts contains the hostname, an empty list rejects all forwarded
+// hosts. Entries may use a leading wildcard (e.g. "*.example.com") to allow all
+// subdomains.
+//
+// If ClientHeader is set, the client address is taken from the specified
+// single address header (e.g. "X-Real-IP") instead.
+//
+// If Debug is set, the forwarding headers and all changes to the request are
+// logged to the provided Logger or the default logger if absent.
+//
+// If TrustedProxies is set, the client is selected by walking the forwarded
+// addresses from right to left, starting with the remote address, and selecting
+// the first address that is not a trusted proxy. ForIndex is ignored in this
+// case and the headers are ignored entirely if the remote address itself is
+// not a trusted proxy.
 type ForwardedConfig struct {
-	UseFor   bool
-	UsePort  bool
-	UseProto bool
-	FakeTLS  bool
-	ForIndex int
-	Debug    bool
+	UseFor         bool
+	UsePort        bool
+	UseProto       bool
+	FakeTLS        bool
+	ForIndex       int
+	Debug          bool
+	Headers        ForwardedHeaders
+	TrustedProxies []netip.Prefix
+	UseHost        bool
+	UsePrefix      bool
+	AllowedHosts   []string
+	Logger         *slog.Logger
+	ClientHeader   string
+
+	// set if trusted proxies were requested but none could be parsed
+	trustNone bool
 }
 
 // GoogleCloud can be used with Forwarded to setup proper header parsing for
@@ -31,108 +78,426 @@ func GoogleCloud(fakeTLS bool) ForwardedConfig {
 	}
 }
 
+// LoopbackProxies returns the loopback address ranges.
+func LoopbackProxies() []netip.Prefix {
+	return MustPrefixes("127.0.0.0/8, ::1/128")
+}
+
+// PrivateProxies returns the private address ranges typically used by load
+// balancers within a private network (e.g. AWS ALB or Kubernetes ingresses).
+func PrivateProxies() []netip.Prefix {
+	return MustPrefixes("10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, fc00::/7")
+}
+
+// GoogleCloudProxies returns the address ranges used by Google Cloud load
+// balancers and health checks.
+func GoogleCloudProxies() []netip.Prefix {
+	return MustPrefixes("35.191.0.0/16, 130.211.0.0/22")
+}
+
+// CloudflareProxies returns the address ranges used by Cloudflare as published
+// on https://www.cloudflare.com/ips. As the ranges may change over time, they
+// should be loaded from an up-to-date file using LoadPrefixes if possible.
+func CloudflareProxies() []netip.Prefix {
+	return MustPrefixes(`
+		173.245.48.0/20, 103.21.244.0/22, 103.22.200.0/22, 103.31.4.0/22,
+		141.101.64.0/18, 108.162.192.0/18, 190.93.240.0/20, 188.114.96.0/20,
+		197.234.240.0/22, 198.41.128.0/17, 162.158.0.0/15, 104.16.0.0/13,
+		104.24.0.0/14, 172.64.0.0/13, 131.0.72.0/22,
+		2400:cb00::/32, 2606:4700::/32, 2803:f800::/32, 2405:b500::/32,
+		2405:8100::/32, 2a06:98c0::/29, 2c0f:f248::/32
+	`)
+}
+
+// FastlyProxies returns the address ranges used by Fastly as published on
+// https://api.fastly.com/public-ip-list. As the ranges may change over time,
+// they should be loaded from an up-to-date file using LoadPrefixes if possible.
+func FastlyProxies() []netip.Prefix {
+	return MustPrefixes(`
+		23.235.32.0/20, 43.249.72.0/22, 103.244.50.0/24, 103.245.222.0/23,
+		103.245.224.0/24, 104.156.80.0/20, 140.248.64.0/18, 140.248.128.0/17,
+		146.75.0.0/17, 151.101.0.0/16, 157.52.64.0/18, 167.82.0.0/17,
+		167.82.128.0/20, 167.82.160.0/20, 167.82.224.0/20, 172.111.64.0/18,
+		185.31.16.0/22, 199.27.72.0/21, 199.232.0.0/16,
+		2a04:4e40::/32, 2a04:4e42::/32
+	`)
+}
+
+// AzureFrontDoorProxies returns the address ranges used by Azure Front Door to
+// connect to origins as published with the "AzureFrontDoor.Backend" service
+// tag. The ranges are shared by all Azure customers and the "X-Azure-FDID"
+// header should therefore be checked additionally.
+func AzureFrontDoorProxies() []netip.Prefix {
+	return MustPrefixes("147.243.0.0/16, 2a01:111:2050::/44")
+}
+
+var proxyPresets = map[string]func() []netip.Prefix{
+	"loopback":         LoopbackProxies,
+	"private":          PrivateProxies,
+	"google-cloud":     GoogleCloudProxies,
+	"cloudflare":       CloudflareProxies,
+	"fastly":           FastlyProxies,
+	"azure-front-door": AzureFrontDoorProxies,
+}
+
+// AWSLoadBalancer can be used with Forwarded to setup proper header parsing for
+// traffic from AWS Application and Classic Load Balancers.
+func AWSLoadBalancer(fakeTLS bool) ForwardedConfig {
+	return ForwardedConfig{
+		UseFor:   true,
+		UseProto: true,
+		FakeTLS:  fakeTLS,
+		ForIndex: -1,
+	}
+}
+
+// Cloudflare can be used with Forwarded to setup proper header parsing for
+// traffic from Cloudflare. The client address is taken from the
+// "CF-Connecting-IP" header if the request originates from Cloudflare.
+func Cloudflare(fakeTLS bool) ForwardedConfig {
+	return ForwardedConfig{
+		UseFor:         true,
+		UseProto:       true,
+		FakeTLS:        fakeTLS,
+		ClientHeader:   "CF-Connecting-IP",
+		TrustedProxies: CloudflareProxies(),
+	}
+}
+
+// Fastly can be used with Forwarded to setup proper header parsing for traffic
+// from Fastly. The client address is taken from the "Fastly-Client-IP" header
+// if the request originates from Fastly.
+func Fastly(fakeTLS bool) ForwardedConfig {
+	return ForwardedConfig{
+		UseFor:         true,
+		UseProto:       true,
+		FakeTLS:        fakeTLS,
+		ClientHeader:   "Fastly-Client-IP",
+		TrustedProxies: FastlyProxies(),
+	}
+}
+
+// AzureFrontDoor can be used with Forwarded to setup proper header parsing for
+// traffic from Azure Front Door. The client address is taken from the
+// "X-Azure-ClientIP" header if the request originates from Azure Front Door.
+func AzureFrontDoor(fakeTLS bool) ForwardedConfig {
+	return ForwardedConfig{
+		UseFor:         true,
+		UseProto:       true,
+		FakeTLS:        fakeTLS,
+		ClientHeader:   "X-Azure-ClientIP",
+		TrustedProxies: AzureFrontDoorProxies(),
+	}
+}
+
+// Nginx can be used with Forwarded to setup proper header parsing for traffic
+// from a nginx reverse proxy that sets the "X-Real-IP" header. Only a proxy on
+// the same host is trusted, TrustedProxies may be extended for remote proxies.
+func Nginx(fakeTLS bool) ForwardedConfig {
+	return ForwardedConfig{
+		UseFor:         true,
+		UseProto:       true,
+		FakeTLS:        fakeTLS,
+		ClientHeader:   "X-Real-IP",
+		TrustedProxies: LoopbackProxies(),
+	}
+}
+
+// Traefik can be used with Forwarded to setup proper header parsing for traffic
+// from a Traefik reverse proxy.
+func Traefik(fakeTLS bool) ForwardedConfig {
+	return ForwardedConfig{
+		UseFor:   true,
+		UseProto: true,
+		FakeTLS:  fakeTLS,
+		ForIndex: -1,
+	}
+}
+
+var forwardedPresets = map[string]func(bool) ForwardedConfig{
+	"google-cloud":     GoogleCloud,
+	"aws":              AWSLoadBalancer,
+	"cloudflare":       Cloudflare,
+	"fastly":           Fastly,
+	"azure-front-door": AzureFrontDoor,
+	"nginx":            Nginx,
+	"traefik":          Traefik,
+}
+
 // ParseForwardedConfig will parse a forwarded config from the specified string
 // and return it. This function can be used to infer a configuration on runtime
 // from an environment variable or configuration file. The following comma
 // seperated list of keywords ist supported: "use-for", "use-port", "use-proto",
-// "fake-tls" and "for-index=1".
+// "use-host", "use-prefix", "fake-tls", "for-index=1", "debug", "rfc7239" and
+// "client-header=X-Real-IP". Allowed hosts may be added using the repeatable
+// "allow-host=example.com" keyword. Trusted proxies may be added using the
+// repeatable "trust=10.0.0.0/8", "trust=private" (proxy preset name) and
+// "trust-file=/path/to/file" keywords. Available proxy presets are "loopback",
+// "private", "google-cloud", "cloudflare", "fastly" and "azure-front-door"
+// while "trust=none" trusts no proxy.
+// If trusted proxies are requested but none could be parsed or loaded, no proxy
+// is trusted and the forwarding headers are ignored. A config preset may be
+// selected using "preset=aws" and is extended by the other keywords. Available
+// config presets are "google-cloud", "aws", "cloudflare", "fastly",
+// "azure-front-door", "nginx" and "traefik". Unknown and malformed keywords are
+// ignored, but malformed "trust" and "trust-file" keywords never widen the set
+// of trusted proxies.
 func ParseForwardedConfig(str string) ForwardedConfig {
-	// parse keywords
-	keywords := map[string]string{}
+	config, _ := parseForwardedConfig(str, false)
+	return config
+}
+
+// ParseForwardedConfigStrict works like ParseForwardedConfig but returns an
+// error for unknown and malformed keywords.
+func ParseForwardedConfigStrict(str string) (ForwardedConfig, error) {
+	return parseForwardedConfig(str, true)
+}
+
+func parseForwardedConfig(str string, strict bool) (ForwardedConfig, error) {
+	// prepare config
+	var config ForwardedConfig
+
+	// split keywords
+	var keywords [][]string
 	for _, kw := range strings.Split(str, ",") {
 		kw = strings.TrimSpace(kw)
-		kv := strings.Split(kw, "=")
-		if len(kv) == 1 {
-			keywords[kv[0]] = ""
-		} else if len(kv) == 2 {
-			keywords[kv[0]] = kv[1]
+		if kw == "" {
+			continue
 		}
+		keywords = append(keywords, strings.Split(kw, "="))
 	}
 
-	// get keywords
-	_, useFor := keywords["use-for"]
-	_, usePort := keywords["use-port"]
-	_, useProto := keywords["use-proto"]
-	_, fakeTLS := keywords["fake-tls"]
-	forIndex, _ := strconv.Atoi(keywords["for-index"])
-	_, debug := keywords["debug"]
+	// apply preset first
+	for _, kv := range keywords {
+		if kv[0] == "preset" && len(kv) == 2 {
+			preset, ok := forwardedPresets[kv[1]]
+			if !ok {
+				if strict {
+					return ForwardedConfig{}, fmt.Errorf("serve: unknown forwarded preset %q", kv[1])
+				}
+				continue
+			}
+			config = preset(false)
+		}
+	}
 
-	return ForwardedConfig{
-		UseFor:   useFor,
-		UsePort:  usePort,
-		UseProto: useProto,
-		FakeTLS:  fakeTLS,
-		ForIndex: forIndex,
-		Debug:    debug,
+	// handle keywords
+	var trust bool
+	for _, kv := range keywords {
+		// check format
+		if len(kv) > 2 {
+			if strict {
+				return ForwardedConfig{}, fmt.Errorf("serve: malformed forwarded keyword %q", strings.Join(kv, "="))
+			}
+			continue
+		}
+
+		// get value
+		key := kv[0]
+		value, hasValue := "", len(kv) == 2
+		if hasValue {
+			value = kv[1]
+		}
+
+		// check value
+		switch key {
+		case "use-for", "use-port", "use-proto", "use-host", "use-prefix", "fake-tls", "debug", "rfc7239":
+			if hasValue && strict {
+				return ForwardedConfig{}, fmt.Errorf("serve: unexpected value for forwarded keyword %q", key)
+			}
+		case "for-index", "client-header", "trust", "trust-file", "allow-host", "preset":
+			if !hasValue && strict {
+				return ForwardedConfig{}, fmt.Errorf("serve: missing value for forwarded keyword %q", key)
+			}
+		}
+
+		// apply keyword
+		var err error
+		switch key {
+		case "use-for":
+			config.UseFor = true
+		case "use-port":
+			config.UsePort = true
+		case "use-proto":
+			config.UseProto = true
+		case "use-host":
+			config.UseHost = true
+		case "use-prefix":
+			config.UsePrefix = true
+		case "fake-tls":
+			config.FakeTLS = true
+		case "debug":
+			config.Debug = true
+		case "rfc7239":
+			config.Headers = RFC7239
+		case "for-index":
+			config.ForIndex, err = strconv.Atoi(value)
+			if err != nil {
+				err = fmt.Errorf("serve: invalid forwarded index %q", value)
+			}
+		case "client-header":
+			config.ClientHeader = value
+		case "trust":
+			trust = true
+			if value == "none" {
+				// trust no proxy
+			} else if preset, ok := proxyPresets[value]; ok {
+				config.TrustedProxies = append(config.TrustedProxies, preset()...)
+			} else {
+				var prefix netip.Prefix
+				prefix, err = ParsePrefix(value)
+				if err == nil {
+					config.TrustedProxies = append(config.TrustedProxies, prefix)
+				}
+			}
+		case "trust-file":
+			trust = true
+			var prefixes []netip.Prefix
+			prefixes, err = LoadPrefixes(value)
+			config.TrustedProxies = append(config.TrustedProxies, prefixes...)
+		case "allow-host":
+			if _, ok := validHost(strings.TrimPrefix(value, "*.")); !ok {
+				err = fmt.Errorf("serve: invalid forwarded host %q", value)
+			} else {
+				config.AllowedHosts = append(config.AllowedHosts, value)
+			}
+		case "preset":
+			// already applied
+		default:
+			err = fmt.Errorf("serve: unknown forwarded keyword %q", key)
+		}
+		if err != nil && strict {
+			return ForwardedConfig{}, err
+		}
+	}
+
+	// trust no proxy instead of all if the requested proxies could not be
+	// parsed or loaded
+	if trust && len(config.TrustedProxies) == 0 {
+		config.trustNone = true
+	}
+
+	return config, nil
+}
+
+// String returns the config encoded as keywords understood by
+// ParseForwardedConfig. The Logger is not encoded.
+func (c ForwardedConfig) String() string {
+	// collect keywords
+	var keywords []string
+	add := func(ok bool, kw string) {
+		if ok {
+			keywords = append(keywords, kw)
+		}
 	}
+	add(c.UseFor, "use-for")
+	add(c.UsePort, "use-port")
+	add(c.UseProto, "use-proto")
+	add(c.UseHost, "use-host")
+	add(c.UsePrefix, "use-prefix")
+	add(c.FakeTLS, "fake-tls")
+	add(c.ForIndex != 0, "for-index="+strconv.Itoa(c.ForIndex))
+	add(c.Debug, "debug")
+	add(c.Headers == RFC7239, "rfc7239")
+	add(c.ClientHeader != "", "client-header="+c.ClientHeader)
+	for _, prefix := range c.TrustedProxies {
+		add(true, "trust="+prefix.String())
+	}
+	add(c.trustNone && len(c.TrustedProxies) == 0, "trust=none")
+	for _, host := range c.AllowedHosts {
+		add(true, "allow-host="+host)
+	}
+
+	return strings.Join(keywords, ",")
 }
 
 // Forwarded is a middleware that will parse the selected "X-Forwarded-X" headers
 // and mutate the request to reflect the conditions described by the headers. As
 // the "X-Forwarded-For" header may contain multiple values, the relative index
-// of the client IP address must be specified.
+// of the client IP address must be specified. If configured, the RFC 7239
+// "Forwarded" header is parsed instead and the index selects the element that
+// describes the client.
 //
 // Note: This technique should only be applied to apps that are behind a load
 // balancer that will *always* set/append the selected headers. Otherwise, an
 // attacker may be able to provide false information and circumvent security
 // limitations.
 func Forwarded(config ForwardedConfig) func(http.Handler) http.Handler {
+	// get logger
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// get ip, port and protocol
 			ip, port, _ := net.SplitHostPort(r.RemoteAddr)
 			protocol := r.URL.Scheme
 
+			// capture original values
+			original := ForwardedOriginal{
+				RemoteAddr: r.RemoteAddr,
+				Scheme:     r.URL.Scheme,
+				Host:       r.Host,
+				TLS:        r.TLS != nil,
+				Header:     http.Header{},
+			}
+			for _, name := range forwardedHeaders {
+				if values := r.Header.Values(name); len(values) > 0 {
+					original.Header[name] = append([]string(nil), values...)
+				}
+			}
+
 			// debug
 			if config.Debug {
-				fmt.Printf("serve: forwarded headers: for=%q, port=%q, proto=%q\n",
-					r.Header.Get("X-Forwarded-For"),
-					r.Header.Get("X-Forwarded-Port"),
-					r.Header.Get("X-Forwarded-Proto"),
+				logger.Info("serve: forwarded headers",
+					slog.String("remote_addr", r.RemoteAddr),
+					slog.Any("headers", original.Header),
 				)
 			}
 
-			// get forwarded for
-			if config.UseFor {
-				// get header
-				forwardedFor := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
-
-				// compute index
-				forwardedIndex := config.ForIndex
-				if forwardedIndex < 0 {
-					forwardedIndex = len(forwardedFor) + forwardedIndex
-				}
+			// get forwarded values
+			var values forwardedValues
+			if config.Headers == RFC7239 {
+				values = rfc7239Forwarded(r, config, ip)
+			} else {
+				values = xForwarded(r, config, ip)
+			}
 
-				// check bounds
-				if forwardedIndex >= 0 && forwardedIndex < len(forwardedFor) {
-					forwardedIP := strings.TrimSpace(forwardedFor[forwardedIndex])
-					if net.ParseIP(forwardedIP) != nil {
-						ip = forwardedIP
-					}
+			// get client header
+			if config.ClientHeader != "" {
+				if client := clientHeader(r, config, ip); client != "" {
+					values.ip = client
 				}
 			}
 
+			// get forwarded for
+			if config.UseFor && values.ip != "" {
+				ip = values.ip
+			}
+
 			// get forwarded port
-			if config.UsePort {
-				forwardedPort := r.Header.Get("X-Forwarded-Port")
-				if n, _ := strconv.Atoi(forwardedPort); n > 0 {
-					port = forwardedPort
-				}
+			if config.UsePort && values.port != "" {
+				port = values.port
 			}
 
 			// get forwarded protocol
-			if config.UseProto {
-				forwardedProtocol := r.Header.Get("X-Forwarded-Proto")
-				if forwardedProtocol == "https" {
-					protocol = "https"
-				}
+			if config.UseProto && values.protocol == "https" {
+				protocol = "https"
+			}
+
+			// get forwarded host
+			host := r.Host
+			if config.UseHost && values.host != "" && config.allowed(values.host) {
+				host = values.host
 			}
 
 			// rewrite remote addr if changed
 			remote := net.JoinHostPort(ip, port)
 			if r.RemoteAddr != remote {
 				if config.Debug {
-					fmt.Printf("==> changing remote addr from %q to %q\n", r.RemoteAddr, remote)
+					logger.Info("serve: changing remote addr", slog.String("from", r.RemoteAddr), slog.String("to", remote))
 				}
 				r.RemoteAddr = remote
 			}
@@ -140,15 +505,39 @@ func Forwarded(config ForwardedConfig) func(http.Handler) http.Handler {
 			// update scheme if changed
 			if r.URL.Scheme != protocol {
 				if config.Debug {
-					fmt.Printf("==> changing url scheme from %q to %q\n", r.URL.Scheme, protocol)
+					logger.Info("serve: changing url scheme", slog.String("from", r.URL.Scheme), slog.String("to", protocol))
 				}
 				r.URL.Scheme = protocol
 			}
 
+			// update host if changed
+			if r.Host != host {
+				if config.Debug {
+					logger.Info("serve: changing host", slog.String("from", r.Host), slog.String("to", host))
+				}
+				r.Host = host
+				r.URL.Host = host
+			}
+
+			// get prefix
+			var prefix string
+			if config.UsePrefix && values.prefix != "" {
+				if config.Debug {
+					logger.Info("serve: setting prefix", slog.String("prefix", values.prefix))
+				}
+				prefix = values.prefix
+			}
+
+			// store prefix and original values
+			r = r.WithContext(context.WithValue(r.Context(), forwardedKey{}, &forwardedContext{
+				prefix:   prefix,
+				original: original,
+			}))
+
 			// fake tls if scheme is https
 			if config.FakeTLS && r.TLS == nil && protocol == "https" {
 				if config.Debug {
-					fmt.Println("=> faking TLS connection")
+					logger.Info("serve: faking TLS connection")
 				}
 				r.TLS = &tls.ConnectionState{
 					Version:           tls.VersionTLS13,
@@ -162,3 +551,406 @@ func Forwarded(config ForwardedConfig) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+type forwardedValues struct {
+	ip       string
+	port     string
+	protocol string
+	host     string
+	prefix   string
+}
+
+func xForwarded(r *http.Request, config ForwardedConfig, remote string) forwardedValues {
+	// ignore headers from untrusted proxies
+	if !config.trusted(remote) {
+		return forwardedValues{}
+	}
+
+	// prepare values
+	var values forwardedValues
+
+	// get forwarded for
+	forwardedFor := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i, hop := range forwardedFor {
+		forwardedFor[i] = strings.TrimSpace(hop)
+	}
+	if i := config.index(forwardedFor); i >= 0 {
+		if net.ParseIP(forwardedFor[i]) != nil {
+			values.ip = forwardedFor[i]
+		}
+	}
+
+	// get forwarded port
+	forwardedPort := r.Header.Get("X-Forwarded-Port")
+	if n, _ := strconv.Atoi(forwardedPort); n > 0 {
+		values.port = forwardedPort
+	}
+
+	// get forwarded protocol
+	values.protocol = r.Header.Get("X-Forwarded-Proto")
+
+	// get forwarded host
+	forwardedHost, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	values.host = strings.TrimSpace(forwardedHost)
+
+	// get forwarded prefix
+	values.prefix = cleanPrefix(r.Header.Get("X-Forwarded-Prefix"))
+
+	return values
+}
+
+func rfc7239Forwarded(r *http.Request, config ForwardedConfig, remote string) forwardedValues {
+	// ignore headers from untrusted proxies
+	if !config.trusted(remote) {
+		return forwardedValues{}
+	}
+
+	// parse elements
+	elements := parseForwarded(strings.Join(r.Header.Values("Forwarded"), ","))
+
+	// get hops
+	hops := make([]string, 0, len(elements))
+	for _, element := range elements {
+		ip, _ := parseForwardedNode(element["for"])
+		hops = append(hops, ip)
+	}
+
+	// prepare values
+	values := forwardedValues{
+		prefix: cleanPrefix(r.Header.Get("X-Forwarded-Prefix")),
+	}
+
+	// select element
+	i := config.index(hops)
+	if i < 0 {
+		return values
+	}
+
+	// get node
+	values.ip, values.port = parseForwardedNode(elements[i]["for"])
+	values.protocol = strings.ToLower(elements[i]["proto"])
+	values.host = elements[i]["host"]
+
+	return values
+}
+
+func (c ForwardedConfig) allowed(host string) bool {
+	// check host
+	hostname, ok := validHost(host)
+	if !ok {
+		return false
+	}
+
+	// check allowed hosts
+	for _, allowed := range c.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if allowed == hostname {
+			return true
+		} else if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(hostname, allowed[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validHost(host string) (string, bool) {
+	// check length
+	if host == "" || len(host) > 255 {
+		return "", false
+	}
+
+	// split port
+	hostname := host
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end < 0 {
+			return "", false
+		}
+		hostname = host[1:end]
+		if rest := host[end+1:]; rest != "" && !validPort(strings.TrimPrefix(rest, ":")) {
+			return "", false
+		}
+		if _, err := netip.ParseAddr(hostname); err != nil {
+			return "", false
+		}
+		return strings.ToLower(hostname), true
+	} else if h, p, ok := strings.Cut(host, ":"); ok {
+		if !validPort(p) {
+			return "", false
+		}
+		hostname = h
+	}
+
+	// check characters
+	for _, c := range hostname {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-') {
+			return "", false
+		}
+	}
+
+	// check labels
+	if hostname == "" || strings.HasPrefix(hostname, ".") || strings.Contains(hostname, "..") {
+		return "", false
+	}
+
+	return strings.ToLower(hostname), true
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func cleanPrefix(prefix string) string {
+	// get first value
+	prefix, _, _ = strings.Cut(prefix, ",")
+	prefix = strings.TrimSpace(prefix)
+
+	// check prefix
+	if !strings.HasPrefix(prefix, "/") || strings.Contains(prefix, "..") || strings.Contains(prefix, "//") || strings.ContainsAny(prefix, "?#\\") {
+		return ""
+	}
+
+	// clean prefix
+	prefix = path.Clean(prefix)
+	if prefix == "/" {
+		return ""
+	}
+
+	return prefix
+}
+
+var forwardedHeaders = []string{
+	"X-Forwarded-For",
+	"X-Forwarded-Port",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+	"X-Forwarded-Prefix",
+	"Forwarded",
+}
+
+// ForwardedOriginal describes a request before it was mutated by Forwarded.
+type ForwardedOriginal struct {
+	// The original remote address, URL scheme and host.
+	RemoteAddr string
+	Scheme     string
+	Host       string
+
+	// Whether the request was received over TLS.
+	TLS bool
+
+	// The received forwarding headers.
+	Header http.Header
+}
+
+type forwardedKey struct{}
+
+type forwardedContext struct {
+	prefix   string
+	original ForwardedOriginal
+}
+
+// ForwardedPrefix returns the external path prefix recorded by the Forwarded
+// middleware or an empty string if there is none.
+func ForwardedPrefix(r *http.Request) string {
+	fc, _ := r.Context().Value(forwardedKey{}).(*forwardedContext)
+	if fc == nil {
+		return ""
+	}
+
+	return fc.prefix
+}
+
+// OriginalRequest returns the original request values recorded by the
+// Forwarded middleware. It returns false if the middleware was not used.
+func OriginalRequest(r *http.Request) (ForwardedOriginal, bool) {
+	fc, _ := r.Context().Value(forwardedKey{}).(*forwardedContext)
+	if fc == nil {
+		return ForwardedOriginal{}, false
+	}
+
+	return fc.original, true
+}
+
+// ExternalURL returns the external URL for the provided path based on the
+// scheme, host and prefix of the request as established by Forwarded.
+func ExternalURL(r *http.Request, urlPath string) string {
+	// ensure leading slash
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+
+	return requestScheme(r) + "://" + r.Host + ForwardedPrefix(r) + urlPath
+}
+
+func clientHeader(r *http.Request, config ForwardedConfig, remote string) string {
+	// ignore headers from untrusted proxies
+	if !config.trusted(remote) {
+		return ""
+	}
+
+	// get address
+	ip := strings.TrimSpace(r.Header.Get(config.ClientHeader))
+	if net.ParseIP(ip) == nil {
+		return ""
+	}
+
+	return ip
+}
+
+func (c ForwardedConfig) trusted(remote string) bool {
+	// trust all if no proxies are configured
+	if len(c.TrustedProxies) == 0 {
+		return !c.trustNone
+	}
+
+	// check address
+	addr, err := netip.ParseAddr(remote)
+	if err != nil {
+		return false
+	}
+
+	return containsAddr(c.TrustedProxies, addr)
+}
+
+func (c ForwardedConfig) index(hops []string) int {
+	// use fixed index if no proxies are configured
+	if len(c.TrustedProxies) == 0 {
+		return forwardedIndex(len(hops), c.ForIndex)
+	}
+
+	// walk hops from right to left and select the first untrusted address
+	for i := len(hops) - 1; i >= 0; i-- {
+		// stop on invalid addresses as they cannot be trusted
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			return -1
+		}
+
+		// select untrusted address
+		if !containsAddr(c.TrustedProxies, addr) {
+			return i
+		}
+	}
+
+	// otherwise, select leftmost address
+	if len(hops) > 0 {
+		return 0
+	}
+
+	return -1
+}
+
+func forwardedIndex(length, index int) int {
+	// compute index
+	if index < 0 {
+		index = length + index
+	}
+
+	// check bounds
+	if index < 0 || index >= length {
+		return -1
+	}
+
+	return index
+}
+
+func parseForwarded(header string) []map[string]string {
+	// prepare result
+	var elements []map[string]string
+	element := map[string]string{}
+
+	// prepare pair
+	var pair strings.Builder
+	addPair := func() {
+		key, value, ok := strings.Cut(pair.String(), "=")
+		if ok {
+			element[strings.ToLower(strings.TrimSpace(key))] = unquoteForwarded(strings.TrimSpace(value))
+		}
+		pair.Reset()
+	}
+
+	// scan header
+	var quoted, escaped bool
+	for _, c := range header {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ';':
+			addPair()
+			continue
+		case !quoted && c == ',':
+			addPair()
+			if len(element) > 0 {
+				elements = append(elements, element)
+			}
+			element = map[string]string{}
+			continue
+		}
+		pair.WriteRune(c)
+	}
+
+	// add last element
+	addPair()
+	if len(element) > 0 {
+		elements = append(elements, element)
+	}
+
+	return elements
+}
+
+func unquoteForwarded(value string) string {
+	// check quotes
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	// remove quotes and escapes
+	var b strings.Builder
+	var escaped bool
+	for _, c := range value[1 : len(value)-1] {
+		if !escaped && c == '\\' {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+func parseForwardedNode(node string) (string, string) {
+	// handle plain addresses
+	if net.ParseIP(node) != nil {
+		return node, ""
+	}
+
+	// split node
+	var ip, port string
+	if strings.HasPrefix(node, "[") {
+		end := strings.Index(node, "]")
+		if end < 0 {
+			return "", ""
+		}
+		ip = node[1:end]
+		port = strings.TrimPrefix(node[end+1:], ":")
+	} else {
+		ip, port, _ = strings.Cut(node, ":")
+	}
+
+	// ignore unknown and obfuscated identifiers
+	if net.ParseIP(ip) == nil {
+		ip = ""
+	}
+	if n, _ := strconv.Atoi(port); n <= 0 {
+		port = ""
+	}
+
+	return ip, port
+}
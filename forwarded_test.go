@@ -1,8 +1,16 @@
 package serve
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,6 +32,26 @@ func TestParseForwardedConfig(t *testing.T) {
 		FakeTLS:  true,
 		ForIndex: -2,
 	}, cfg)
+
+	cfg = ParseForwardedConfig("use-host,use-prefix,allow-host=example.com,allow-host=*.example.org")
+	assert.Equal(t, ForwardedConfig{
+		UseHost:      true,
+		UsePrefix:    true,
+		AllowedHosts: []string{"example.com", "*.example.org"},
+	}, cfg)
+
+	cfg = ParseForwardedConfig("use-for,use-proto,for-index=-1,rfc7239")
+	assert.Equal(t, ForwardedConfig{
+		UseFor:   true,
+		UseProto: true,
+		ForIndex: -1,
+		Headers:  RFC7239,
+	}, cfg)
+
+	cfg = ParseForwardedConfig("use-for,trust-file=/missing")
+	assert.Empty(t, cfg.TrustedProxies)
+	assert.False(t, cfg.trusted("1.2.3.4"))
+	assert.Equal(t, "use-for,trust=none", cfg.String())
 }
 
 func TestForwarded(t *testing.T) {
@@ -45,7 +73,13 @@ func TestForwarded(t *testing.T) {
 	assert.Equal(t, "192.0.2.1:1234: URL: http://example.com, TLS: false", r.Body.String())
 
 	handler = Compose(
-		Forwarded(ForwardedConfig{true, true, true, true, 0, false}),
+		Forwarded(ForwardedConfig{
+			UseFor:   true,
+			UsePort:  true,
+			UseProto: true,
+			FakeTLS:  true,
+			ForIndex: 0,
+		}),
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			str := fmt.Sprintf("%s: URL: %s, TLS: %v", r.RemoteAddr, r.URL.String(), r.TLS != nil)
 			_, _ = w.Write([]byte(str))
@@ -91,7 +125,13 @@ func TestForwarded(t *testing.T) {
 	assert.Equal(t, "2.3.4.5:1234: URL: http://example.com, TLS: false", r.Body.String())
 
 	handler = Compose(
-		Forwarded(ForwardedConfig{true, true, true, true, -2, false}),
+		Forwarded(ForwardedConfig{
+			UseFor:   true,
+			UsePort:  true,
+			UseProto: true,
+			FakeTLS:  true,
+			ForIndex: -2,
+		}),
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			str := fmt.Sprintf("%s: URL: %s, TLS: %v", r.RemoteAddr, r.URL.String(), r.TLS != nil)
 			_, _ = w.Write([]byte(str))
@@ -116,3 +156,581 @@ func TestForwarded(t *testing.T) {
 	assert.Equal(t, http.StatusOK, r.Code)
 	assert.Equal(t, "2.3.4.5:1234: URL: http://example.com, TLS: false", r.Body.String())
 }
+
+func TestForwardedRFC7239(t *testing.T) {
+	handler := Compose(
+		Forwarded(ForwardedConfig{
+			UseFor:   true,
+			UsePort:  true,
+			UseProto: true,
+			FakeTLS:  true,
+			ForIndex: -1,
+			Headers:  RFC7239,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			str := fmt.Sprintf("%s: URL: %s, TLS: %v", r.RemoteAddr, r.URL.String(), r.TLS != nil)
+			_, _ = w.Write([]byte(str))
+		}),
+	)
+
+	// ignored
+	r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+		"X-Forwarded-For":   "1.2.3.4",
+		"X-Forwarded-Proto": "https",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "192.0.2.1:1234: URL: http://example.com, TLS: false", r.Body.String())
+
+	matrix := []struct {
+		header string
+		result string
+	}{
+		{
+			header: "for=1.2.3.4",
+			result: "1.2.3.4:1234: URL: http://example.com, TLS: false",
+		},
+		{
+			header: "For=\"1.2.3.4:4321\";Proto=HTTPS",
+			result: "1.2.3.4:4321: URL: https://example.com, TLS: true",
+		},
+		{
+			header: "for=\"[2001:db8:cafe::17]:4711\";proto=https;host=example.com",
+			result: "[2001:db8:cafe::17]:4711: URL: https://example.com, TLS: true",
+		},
+		{
+			header: "for=\"[2001:db8:cafe::17]\"",
+			result: "[2001:db8:cafe::17]:1234: URL: http://example.com, TLS: false",
+		},
+		{
+			header: "for=2.3.4.5;proto=https, for=1.2.3.4;proto=http",
+			result: "1.2.3.4:1234: URL: http://example.com, TLS: false",
+		},
+		{
+			header: "for=_hidden;proto=https",
+			result: "192.0.2.1:1234: URL: https://example.com, TLS: true",
+		},
+		{
+			header: "for=unknown",
+			result: "192.0.2.1:1234: URL: http://example.com, TLS: false",
+		},
+		{
+			header: "for=\"1.2.3.4:_port\"",
+			result: "1.2.3.4:1234: URL: http://example.com, TLS: false",
+		},
+		{
+			header: "for=foo",
+			result: "192.0.2.1:1234: URL: http://example.com, TLS: false",
+		},
+		{
+			header: "",
+			result: "192.0.2.1:1234: URL: http://example.com, TLS: false",
+		},
+	}
+
+	for _, item := range matrix {
+		r = Record(nil, handler, "GET", "http://example.com", map[string]string{
+			"Forwarded": item.header,
+		}, "")
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Equal(t, item.result, r.Body.String(), item.header)
+	}
+
+	handler = Compose(
+		Forwarded(ForwardedConfig{
+			UseFor:   true,
+			ForIndex: -2,
+			Headers:  RFC7239,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr))
+		}),
+	)
+
+	r = Record(nil, handler, "GET", "http://example.com", map[string]string{
+		"Forwarded": "for=3.4.5.6, for=2.3.4.5;by=\"[::1]\", for=1.2.3.4",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "2.3.4.5:1234", r.Body.String())
+
+	r = Record(nil, handler, "GET", "http://example.com", map[string]string{
+		"Forwarded": "for=1.2.3.4",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "192.0.2.1:1234", r.Body.String())
+}
+
+func TestParseForwarded(t *testing.T) {
+	elements := parseForwarded(`for="_gazonk";by=203.0.113.43, for="[2001:db8::1]:80";host="a,b;c", for=192.0.2.60;proto=http;by="\"x\""`)
+	assert.Equal(t, []map[string]string{
+		{"for": "_gazonk", "by": "203.0.113.43"},
+		{"for": "[2001:db8::1]:80", "host": "a,b;c"},
+		{"for": "192.0.2.60", "proto": "http", "by": `"x"`},
+	}, elements)
+}
+
+func TestForwardedTrustedProxies(t *testing.T) {
+	handler := Compose(
+		Forwarded(ForwardedConfig{
+			UseFor:         true,
+			UseProto:       true,
+			TrustedProxies: MustPrefixes("192.0.2.0/24, 10.0.0.0/8, fd00::/8"),
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr + " " + r.URL.Scheme))
+		}),
+	)
+
+	matrix := []struct {
+		remote string
+		header string
+		result string
+	}{
+		{
+			header: "",
+			result: "192.0.2.1:1234 https",
+		},
+		{
+			header: "1.2.3.4",
+			result: "1.2.3.4:1234 https",
+		},
+		{
+			header: "1.2.3.4, 10.0.0.1",
+			result: "1.2.3.4:1234 https",
+		},
+		{
+			header: "6.6.6.6, 1.2.3.4, 10.0.0.2, 10.0.0.1",
+			result: "1.2.3.4:1234 https",
+		},
+		{
+			header: "10.0.0.3, 10.0.0.2",
+			result: "10.0.0.3:1234 https",
+		},
+		{
+			header: "1.2.3.4, foo, 10.0.0.1",
+			result: "192.0.2.1:1234 https",
+		},
+		{
+			header: "2001:db8::1, fd00::1",
+			result: "[2001:db8::1]:1234 https",
+		},
+		{
+			remote: "1.1.1.1:1234",
+			header: "1.2.3.4",
+			result: "1.1.1.1:1234 http",
+		},
+	}
+
+	for _, item := range matrix {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		if item.remote != "" {
+			req.RemoteAddr = item.remote
+		}
+		req.Header.Set("X-Forwarded-Proto", "https")
+		if item.header != "" {
+			req.Header.Set("X-Forwarded-For", item.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, item.result, rec.Body.String(), item.header)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "6.6.6.6")
+	req.Header.Add("X-Forwarded-For", "7.7.7.7")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "7.7.7.7:1234 http", rec.Body.String())
+
+	handler = Compose(
+		Forwarded(ForwardedConfig{
+			UseFor:         true,
+			UseProto:       true,
+			Headers:        RFC7239,
+			TrustedProxies: MustPrefixes("192.0.2.0/24, 10.0.0.0/8"),
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr + " " + r.URL.Scheme))
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+		"Forwarded": "for=6.6.6.6;proto=http, for=1.2.3.4;proto=https, for=10.0.0.1;proto=http",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "1.2.3.4:1234 https", r.Body.String())
+}
+
+func TestForwardedProxyPresets(t *testing.T) {
+	for _, preset := range proxyPresets {
+		assert.NotEmpty(t, preset())
+	}
+
+	assert.True(t, containsAddr(LoopbackProxies(), netip.MustParseAddr("::1")))
+	assert.True(t, containsAddr(PrivateProxies(), netip.MustParseAddr("172.20.1.1")))
+	assert.True(t, containsAddr(GoogleCloudProxies(), netip.MustParseAddr("35.191.1.1")))
+	assert.True(t, containsAddr(CloudflareProxies(), netip.MustParseAddr("2606:4700::1")))
+}
+
+func TestParseForwardedConfigTrusted(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "proxies.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("1.2.3.0/24\n"), 0644))
+
+	cfg := ParseForwardedConfig("use-for,trust=loopback,trust=10.0.0.0/8,trust=foo,trust-file=" + file)
+	assert.Equal(t, ForwardedConfig{
+		UseFor:         true,
+		TrustedProxies: append(LoopbackProxies(), MustPrefixes("10.0.0.0/8, 1.2.3.0/24")...),
+	}, cfg)
+
+	for _, str := range []string{"use-for,trust=foo", "use-for,trust=none"} {
+		cfg = ParseForwardedConfig(str)
+		assert.Empty(t, cfg.TrustedProxies, str)
+		assert.Equal(t, "use-for,trust=none", cfg.String(), str)
+
+		handler := Compose(
+			Forwarded(cfg),
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(r.RemoteAddr))
+			}),
+		)
+
+		r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+			"X-Forwarded-For": "1.2.3.4",
+		}, "")
+		assert.Equal(t, http.StatusOK, r.Code, str)
+		assert.Equal(t, "192.0.2.1:1234", r.Body.String(), str)
+	}
+
+	parsed, err := ParseForwardedConfigStrict("use-for,trust=none")
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, parsed)
+}
+
+func TestForwardedPresets(t *testing.T) {
+	for _, preset := range forwardedPresets {
+		Forwarded(preset(false))
+	}
+
+	handler := Compose(
+		Forwarded(Nginx(false)),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr))
+		}),
+	)
+
+	request := func(remote string, headers map[string]string) string {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = remote
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "1.2.3.4:1234", request("127.0.0.1:1234", map[string]string{
+		"X-Forwarded-For": "6.6.6.6, 1.2.3.4",
+		"X-Real-IP":       "1.2.3.4",
+	}))
+	assert.Equal(t, "6.6.6.6:1234", request("127.0.0.1:1234", map[string]string{
+		"X-Forwarded-For": "6.6.6.6",
+		"X-Real-IP":       "foo",
+	}))
+	assert.Equal(t, "192.0.2.1:1234", request("192.0.2.1:1234", map[string]string{
+		"X-Real-IP": "1.2.3.4",
+	}))
+
+	handler = Compose(
+		Forwarded(Fastly(false)),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr))
+		}),
+	)
+
+	assert.Equal(t, "1.2.3.4:1234", request("151.101.1.1:1234", map[string]string{
+		"Fastly-Client-IP": "1.2.3.4",
+	}))
+	assert.Equal(t, "192.0.2.1:1234", request("192.0.2.1:1234", map[string]string{
+		"Fastly-Client-IP": "1.2.3.4",
+	}))
+
+	handler = Compose(
+		Forwarded(Cloudflare(false)),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr))
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+		"CF-Connecting-IP": "1.2.3.4",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "192.0.2.1:1234", r.Body.String())
+
+	for name, preset := range forwardedPresets {
+		for _, fakeTLS := range []bool{false, true} {
+			cfg := preset(fakeTLS)
+			parsed, err := ParseForwardedConfigStrict(cfg.String())
+			assert.NoError(t, err, name)
+			assert.Equal(t, cfg, parsed, name)
+		}
+
+		parsed, err := ParseForwardedConfigStrict("preset=" + name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, preset(false), parsed, name)
+	}
+}
+
+func TestParseForwardedConfigStrict(t *testing.T) {
+	cfg, err := ParseForwardedConfigStrict("preset=cloudflare, fake-tls, client-header=x-real-ip, for-index=1, allow-host=*.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, ForwardedConfig{
+		UseFor:         true,
+		UseProto:       true,
+		FakeTLS:        true,
+		ForIndex:       1,
+		ClientHeader:   "x-real-ip",
+		TrustedProxies: CloudflareProxies(),
+		AllowedHosts:   []string{"*.example.com"},
+	}, cfg)
+
+	for _, str := range []string{
+		"foo",
+		"use-for=true",
+		"for-index",
+		"for-index=foo",
+		"trust=foo",
+		"trust-file=/missing",
+		"allow-host=foo/bar",
+		"preset=foo",
+		"client-header=a=b",
+	} {
+		_, err = ParseForwardedConfigStrict(str)
+		assert.Error(t, err, str)
+
+		assert.NotPanics(t, func() {
+			ParseForwardedConfig(str)
+		})
+	}
+}
+
+func TestForwardedConfigString(t *testing.T) {
+	assert.Equal(t, "", ForwardedConfig{}.String())
+
+	cfg := ForwardedConfig{
+		UseFor:         true,
+		UsePort:        true,
+		UseProto:       true,
+		FakeTLS:        true,
+		ForIndex:       -1,
+		Debug:          true,
+		Headers:        RFC7239,
+		TrustedProxies: MustPrefixes("10.0.0.0/8, ::1/128"),
+		UseHost:        true,
+		UsePrefix:      true,
+		AllowedHosts:   []string{"example.com"},
+		ClientHeader:   "X-Real-Ip",
+	}
+	assert.Equal(t, "use-for,use-port,use-proto,use-host,use-prefix,fake-tls,for-index=-1,debug,rfc7239,client-header=X-Real-Ip,trust=10.0.0.0/8,trust=::1/128,allow-host=example.com", cfg.String())
+
+	parsed, err := ParseForwardedConfigStrict(cfg.String())
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, parsed)
+}
+
+func TestForwardedHostAndPrefix(t *testing.T) {
+	handler := Compose(
+		Forwarded(ForwardedConfig{
+			UseProto:     true,
+			UseHost:      true,
+			UsePrefix:    true,
+			AllowedHosts: []string{"example.com", "*.example.org"},
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Host + " " + r.URL.Host + " " + ForwardedPrefix(r) + " " + ExternalURL(r, "foo")))
+		}),
+	)
+
+	matrix := []struct {
+		host   string
+		prefix string
+		result string
+	}{
+		{
+			result: "internal internal  https://internal/foo",
+		},
+		{
+			host:   "example.com",
+			prefix: "/app",
+			result: "example.com example.com /app https://example.com/app/foo",
+		},
+		{
+			host:   "EXAMPLE.com:8443",
+			prefix: "/app/",
+			result: "EXAMPLE.com:8443 EXAMPLE.com:8443 /app https://EXAMPLE.com:8443/app/foo",
+		},
+		{
+			host:   "api.example.org, evil.com",
+			prefix: "/",
+			result: "api.example.org api.example.org  https://api.example.org/foo",
+		},
+		{
+			host:   "example.org",
+			prefix: "/../admin",
+			result: "internal internal  https://internal/foo",
+		},
+		{
+			host:   "evil.com",
+			prefix: "//evil.com",
+			result: "internal internal  https://internal/foo",
+		},
+		{
+			host:   "example.com/foo",
+			prefix: "app",
+			result: "internal internal  https://internal/foo",
+		},
+		{
+			host:   "example.com:foo",
+			result: "internal internal  https://internal/foo",
+		},
+	}
+
+	for _, item := range matrix {
+		req := httptest.NewRequest("GET", "http://internal/foo", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		if item.host != "" {
+			req.Header.Set("X-Forwarded-Host", item.host)
+		}
+		if item.prefix != "" {
+			req.Header.Set("X-Forwarded-Prefix", item.prefix)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, item.result, rec.Body.String(), item.host)
+	}
+
+	handler = Compose(
+		Forwarded(ForwardedConfig{
+			UseHost:      true,
+			ForIndex:     -1,
+			Headers:      RFC7239,
+			AllowedHosts: []string{"2001:db8::1", "evil.com"},
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Host))
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "http://internal/foo", map[string]string{
+		"Forwarded": `for=1.2.3.4;host="[2001:db8::1]:8080"`,
+	}, "")
+	assert.Equal(t, "[2001:db8::1]:8080", r.Body.String())
+
+	r = Record(nil, handler, "GET", "http://internal/foo", map[string]string{
+		"Forwarded": `for=1.2.3.4;host="evil.com\r\nX-Foo: bar"`,
+	}, "")
+	assert.Equal(t, "internal", r.Body.String())
+
+	handler = Compose(
+		Forwarded(ForwardedConfig{
+			UseHost: true,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Host))
+		}),
+	)
+
+	r = Record(nil, handler, "GET", "http://internal/foo", map[string]string{
+		"X-Forwarded-Host": "example.com",
+	}, "")
+	assert.Equal(t, "internal", r.Body.String())
+}
+
+func TestForwardedSecurePrefix(t *testing.T) {
+	handler := Compose(
+		Forwarded(ForwardedConfig{
+			UseHost:      true,
+			UsePrefix:    true,
+			AllowedHosts: []string{"example.com"},
+		}),
+		Security(false, false, 0),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	r := Record(nil, handler, "GET", "http://internal/foo?bar=baz", map[string]string{
+		"X-Forwarded-Host":   "example.com",
+		"X-Forwarded-Prefix": "/app",
+	}, "")
+	assert.Equal(t, http.StatusMovedPermanently, r.Code)
+	assert.Equal(t, "https://example.com/app/foo?bar=baz", r.Header().Get("Location"))
+}
+
+func TestExternalURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/foo", nil)
+	assert.Equal(t, "http://example.com/bar", ExternalURL(r, "/bar"))
+
+	r = httptest.NewRequest("GET", "https://example.org/foo", nil)
+	assert.Equal(t, "https://example.org/", ExternalURL(r, ""))
+}
+
+func TestForwardedDebugAndOriginal(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	var original ForwardedOriginal
+	var ok bool
+	handler := Compose(
+		Forwarded(ForwardedConfig{
+			UseFor:       true,
+			UseProto:     true,
+			UseHost:      true,
+			FakeTLS:      true,
+			Debug:        true,
+			Logger:       logger,
+			AllowedHosts: []string{"example.com"},
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			original, ok = OriginalRequest(r)
+			_, _ = w.Write([]byte(r.RemoteAddr))
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "http://internal/foo", map[string]string{
+		"X-Forwarded-For":   "1.2.3.4",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "example.com",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "1.2.3.4:1234", r.Body.String())
+	assert.True(t, ok)
+	assert.Equal(t, ForwardedOriginal{
+		RemoteAddr: "192.0.2.1:1234",
+		Scheme:     "http",
+		Host:       "internal",
+		Header: http.Header{
+			"X-Forwarded-For":   []string{"1.2.3.4"},
+			"X-Forwarded-Proto": []string{"https"},
+			"X-Forwarded-Host":  []string{"example.com"},
+		},
+	}, original)
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		messages = append(messages, entry["msg"].(string))
+	}
+	assert.Equal(t, []string{
+		"serve: forwarded headers",
+		"serve: changing remote addr",
+		"serve: changing url scheme",
+		"serve: changing host",
+		"serve: faking TLS connection",
+	}, messages)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	_, ok = OriginalRequest(req)
+	assert.False(t, ok)
+	assert.Equal(t, "", ForwardedPrefix(req))
+}
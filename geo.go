@@ -0,0 +1,258 @@
+package serve
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoInfo contains the geographical and network information of a client.
+type GeoInfo struct {
+	// The ISO 3166-1 alpha-2 country code (e.g. "DE").
+	Country string
+
+	// The autonomous system number and organization.
+	ASN          uint
+	Organization string
+}
+
+// GeoConfig defines the databases and settings used for the geo enrichment.
+//
+// CountryDB and ASNDB name MaxMind DB files (e.g. "GeoLite2-Country.mmdb" and
+// "GeoLite2-ASN.mmdb"). City databases may be used as country databases. The
+// client address is determined using the Resolver, which defaults to the remote
+// address as established by Forwarded. Up to CacheSize lookups (defaults to
+// 10000) are cached in memory.
+type GeoConfig struct {
+	CountryDB string
+	ASNDB     string
+	Resolver  IPResolver
+	CacheSize int
+}
+
+type geoKey struct{}
+
+// Geo will return a middleware that looks up the client IP address in the
+// configured databases and stores the result in the request context. The
+// information can be retrieved using GeoLookup. It will panic if a database
+// cannot be opened.
+func Geo(config GeoConfig) func(http.Handler) http.Handler {
+	// set default cache size
+	if config.CacheSize == 0 {
+		config.CacheSize = 10000
+	}
+
+	// open databases
+	var countryDB, asnDB *maxminddb.Reader
+	var err error
+	if config.CountryDB != "" {
+		countryDB, err = maxminddb.Open(config.CountryDB)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if config.ASNDB != "" {
+		asnDB, err = maxminddb.Open(config.ASNDB)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// prepare cache
+	cache := &geoCache{
+		size:    config.CacheSize,
+		list:    list.New(),
+		entries: map[netip.Addr]*list.Element{},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// get address
+			addr := ClientIP(r, config.Resolver)
+
+			// get info
+			info, ok := cache.get(addr)
+			if !ok {
+				info = geoLookup(countryDB, asnDB, addr)
+				cache.put(addr, info)
+			}
+
+			// store info
+			r = r.WithContext(context.WithValue(r.Context(), geoKey{}, info))
+
+			// call next
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GeoLookup returns the geo information stored by Geo.
+func GeoLookup(r *http.Request) (GeoInfo, bool) {
+	info, ok := r.Context().Value(geoKey{}).(GeoInfo)
+	return info, ok
+}
+
+// GeoFilterConfig defines the allowed and denied countries.
+//
+// Allow and Deny are lists of ISO 3166-1 alpha-2 country codes. A request is
+// blocked if the country is denied, or if Allow is configured and the country
+// is not allowed. Requests with an unknown country are only blocked in the
+// latter case. Blocked requests are answered with the configured Status
+// (defaults to 403) and reported to the Reporter if available.
+type GeoFilterConfig struct {
+	Allow    []string
+	Deny     []string
+	Status   int
+	Reporter func(r *http.Request, info GeoInfo)
+}
+
+// GeoFilter will return a middleware that blocks requests based on the client
+// country as determined by Geo, which must be run before. It will panic if Geo
+// has not been run for a request.
+func GeoFilter(config GeoFilterConfig) func(http.Handler) http.Handler {
+	// set default status
+	if config.Status == 0 {
+		config.Status = http.StatusForbidden
+	}
+
+	// prepare lists
+	allow := map[string]bool{}
+	for _, country := range config.Allow {
+		allow[strings.ToUpper(country)] = true
+	}
+	deny := map[string]bool{}
+	for _, country := range config.Deny {
+		deny[strings.ToUpper(country)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// get info
+			info, ok := GeoLookup(r)
+			if !ok {
+				panic("serve: missing geo info")
+			}
+
+			// check country
+			blocked := len(allow) > 0 && !allow[info.Country]
+			if deny[info.Country] {
+				blocked = true
+			}
+
+			// handle blocked requests
+			if blocked {
+				if config.Reporter != nil {
+					config.Reporter(r, info)
+				}
+				w.WriteHeader(config.Status)
+				return
+			}
+
+			// call next
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type geoCountryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+type geoASNRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+func geoLookup(countryDB, asnDB *maxminddb.Reader, addr netip.Addr) GeoInfo {
+	// prepare info
+	var info GeoInfo
+
+	// check address
+	if !addr.IsValid() {
+		return info
+	}
+
+	// lookup country, errors are treated as unknown
+	if countryDB != nil {
+		var record geoCountryRecord
+		if countryDB.Lookup(addr.AsSlice(), &record) == nil {
+			info.Country = record.Country.ISOCode
+			if info.Country == "" {
+				info.Country = record.RegisteredCountry.ISOCode
+			}
+		}
+	}
+
+	// lookup ASN, errors are treated as unknown
+	if asnDB != nil {
+		var record geoASNRecord
+		if asnDB.Lookup(addr.AsSlice(), &record) == nil {
+			info.ASN = record.Number
+			info.Organization = record.Organization
+		}
+	}
+
+	return info
+}
+
+type geoEntry struct {
+	addr netip.Addr
+	info GeoInfo
+}
+
+type geoCache struct {
+	size    int
+	mutex   sync.Mutex
+	list    *list.List
+	entries map[netip.Addr]*list.Element
+}
+
+func (c *geoCache) get(addr netip.Addr) (GeoInfo, bool) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// get entry
+	elem, ok := c.entries[addr]
+	if !ok {
+		return GeoInfo{}, false
+	}
+
+	// mark used
+	c.list.MoveToFront(elem)
+
+	return elem.Value.(*geoEntry).info, true
+}
+
+func (c *geoCache) put(addr netip.Addr, info GeoInfo) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// update existing entry
+	if elem, ok := c.entries[addr]; ok {
+		elem.Value.(*geoEntry).info = info
+		c.list.MoveToFront(elem)
+		return
+	}
+
+	// add entry
+	c.entries[addr] = c.list.PushFront(&geoEntry{addr: addr, info: info})
+
+	// evict least recently used entries
+	for c.list.Len() > c.size {
+		elem := c.list.Back()
+		c.list.Remove(elem)
+		delete(c.entries, elem.Value.(*geoEntry).addr)
+	}
+}
@@ -0,0 +1,237 @@
+package serve
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeo(t *testing.T) {
+	dir := t.TempDir()
+	countryDB := filepath.Join(dir, "country.mmdb")
+	asnDB := filepath.Join(dir, "asn.mmdb")
+
+	writeMMDB(t, countryDB, map[string]map[string]any{
+		"1.2.3.0/24": {"country": map[string]any{"iso_code": "DE"}},
+		"5.6.0.0/16": {"registered_country": map[string]any{"iso_code": "US"}},
+	})
+	writeMMDB(t, asnDB, map[string]map[string]any{
+		"1.2.0.0/16": {"autonomous_system_number": uint32(64512), "autonomous_system_organization": "Example"},
+	})
+
+	handler := Compose(
+		Geo(GeoConfig{
+			CountryDB: countryDB,
+			ASNDB:     asnDB,
+			Resolver:  RealIPResolver(nil),
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info, ok := GeoLookup(r)
+			assert.True(t, ok)
+			_ = json.NewEncoder(w).Encode(info)
+		}),
+	)
+
+	matrix := []struct {
+		ip   string
+		info string
+	}{
+		{ip: "1.2.3.4", info: `{"Country":"DE","ASN":64512,"Organization":"Example"}`},
+		{ip: "::ffff:1.2.3.4", info: `{"Country":"DE","ASN":64512,"Organization":"Example"}`},
+		{ip: "1.2.4.4", info: `{"Country":"","ASN":64512,"Organization":"Example"}`},
+		{ip: "5.6.7.8", info: `{"Country":"US","ASN":0,"Organization":""}`},
+		{ip: "9.9.9.9", info: `{"Country":"","ASN":0,"Organization":""}`},
+		{ip: "2001:db8::1", info: `{"Country":"","ASN":0,"Organization":""}`},
+		{ip: "foo", info: `{"Country":"","ASN":0,"Organization":""}`},
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, item := range matrix {
+			r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+				"X-Real-IP": item.ip,
+			}, "")
+			assert.Equal(t, http.StatusOK, r.Code, item.ip)
+			assert.JSONEq(t, item.info, r.Body.String(), item.ip)
+		}
+	}
+
+	assert.Panics(t, func() {
+		Geo(GeoConfig{
+			CountryDB: filepath.Join(dir, "missing.mmdb"),
+		})
+	})
+}
+
+func TestGeoFilter(t *testing.T) {
+	countryDB := filepath.Join(t.TempDir(), "country.mmdb")
+	writeMMDB(t, countryDB, map[string]map[string]any{
+		"1.2.3.0/24": {"country": map[string]any{"iso_code": "DE"}},
+		"5.6.0.0/16": {"country": map[string]any{"iso_code": "US"}},
+		"7.8.0.0/16": {"country": map[string]any{"iso_code": "FR"}},
+	})
+
+	var reported []string
+	handler := Compose(
+		Geo(GeoConfig{
+			CountryDB: countryDB,
+			Resolver:  RealIPResolver(nil),
+		}),
+		GeoFilter(GeoFilterConfig{
+			Allow: []string{"de", "US"},
+			Deny:  []string{"US"},
+			Reporter: func(r *http.Request, info GeoInfo) {
+				reported = append(reported, info.Country)
+			},
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	matrix := []struct {
+		ip   string
+		code int
+	}{
+		{ip: "1.2.3.4", code: http.StatusOK},
+		{ip: "5.6.7.8", code: http.StatusForbidden},
+		{ip: "7.8.9.0", code: http.StatusForbidden},
+		{ip: "9.9.9.9", code: http.StatusForbidden},
+	}
+
+	for _, item := range matrix {
+		r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+			"X-Real-IP": item.ip,
+		}, "")
+		assert.Equal(t, item.code, r.Code, item.ip)
+	}
+
+	assert.Equal(t, []string{"US", "FR", ""}, reported)
+}
+
+func TestGeoCache(t *testing.T) {
+	cache := &geoCache{
+		size:    2,
+		list:    list.New(),
+		entries: map[netip.Addr]*list.Element{},
+	}
+
+	a := netip.MustParseAddr("1.1.1.1")
+	b := netip.MustParseAddr("2.2.2.2")
+	c := netip.MustParseAddr("3.3.3.3")
+
+	cache.put(a, GeoInfo{Country: "A"})
+	cache.put(b, GeoInfo{Country: "B"})
+	_, ok := cache.get(a)
+	assert.True(t, ok)
+
+	cache.put(c, GeoInfo{Country: "C"})
+	_, ok = cache.get(b)
+	assert.False(t, ok)
+
+	info, ok := cache.get(a)
+	assert.True(t, ok)
+	assert.Equal(t, "A", info.Country)
+}
+
+// writeMMDB writes a minimal IPv4 MaxMind DB file with the provided records.
+func writeMMDB(t *testing.T, file string, records map[string]map[string]any) {
+	// prepare tree and data
+	nodes := [][2]int{{-1, -1}}
+	var data bytes.Buffer
+	var pointers [][2]int
+
+	// insert records
+	for str, record := range records {
+		prefix := netip.MustParsePrefix(str)
+		offset := data.Len()
+		encodeMMDB(&data, record)
+
+		ip := prefix.Addr().As4()
+		node := 0
+		for i := 0; i < prefix.Bits(); i++ {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == prefix.Bits()-1 {
+				pointers = append(pointers, [2]int{node*2 + bit, offset})
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	// resolve records
+	count := len(nodes)
+	records24 := make([]int, count*2)
+	for i, node := range nodes {
+		for j, child := range node {
+			if child < 0 {
+				child = count
+			}
+			records24[i*2+j] = child
+		}
+	}
+	for _, pointer := range pointers {
+		records24[pointer[0]] = count + 16 + pointer[1]
+	}
+
+	// write tree
+	var buf bytes.Buffer
+	for _, record := range records24 {
+		buf.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+	}
+
+	// write data
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+
+	// write metadata
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDB(&buf, map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               "Test",
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint32(0),
+	})
+
+	assert.NoError(t, os.WriteFile(file, buf.Bytes(), 0644))
+}
+
+func encodeMMDB(buf *bytes.Buffer, value any) {
+	switch value := value.(type) {
+	case string:
+		if len(value) < 29 {
+			buf.WriteByte(2<<5 | byte(len(value)))
+		} else {
+			buf.Write([]byte{2<<5 | 29, byte(len(value) - 29)})
+		}
+		buf.WriteString(value)
+	case uint16:
+		buf.WriteByte(5<<5 | 2)
+		_ = binary.Write(buf, binary.BigEndian, value)
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		_ = binary.Write(buf, binary.BigEndian, value)
+	case map[string]any:
+		buf.WriteByte(7<<5 | byte(len(value)))
+		for key, val := range value {
+			encodeMMDB(buf, key)
+			encodeMMDB(buf, val)
+		}
+	default:
+		panic("unsupported type")
+	}
+}
@@ -2,7 +2,12 @@ package serve
 
 import (
 	"net"
+	"net/http"
+	"net/netip"
 	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
 )
 
 // Hostname will return the hostname from the provided host string. This method
@@ -22,3 +27,72 @@ func IP(addr string) string {
 
 	return ip
 }
+
+// RequestInfo contains information about a request.
+type RequestInfo struct {
+	// The scheme, hostname and port of the request. The port defaults to the
+	// scheme's default port if not specified.
+	Scheme string
+	Host   string
+	Port   string
+
+	// The client IP address as determined by ClientIP.
+	ClientIP netip.Addr
+
+	// The external base URL including the forwarded prefix.
+	BaseURL string
+
+	// Whether the request was received over TLS.
+	Secure bool
+
+	// The registrable domain (e.g. "example.co.uk") of the host as determined
+	// by the public suffix list. Empty for IP addresses and public suffixes.
+	Domain string
+}
+
+// Info will return information about the provided request as established by
+// Forwarded. The request is not modified.
+func Info(r *http.Request) RequestInfo {
+	// get scheme
+	scheme := requestScheme(r)
+
+	// get host and port
+	host := Hostname(r.Host)
+	port := (&url.URL{Host: r.Host}).Port()
+	if port == "" {
+		port = "80"
+		if scheme == "https" {
+			port = "443"
+		}
+	}
+
+	// get domain
+	var domain string
+	if _, err := netip.ParseAddr(host); err != nil && host != "" {
+		domain, _ = publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(strings.ToLower(host), "."))
+	}
+
+	return RequestInfo{
+		Scheme:   scheme,
+		Host:     host,
+		Port:     port,
+		ClientIP: ClientIP(r, nil),
+		BaseURL:  scheme + "://" + r.Host + ForwardedPrefix(r),
+		Secure:   r.TLS != nil || scheme == "https",
+		Domain:   domain,
+	}
+}
+
+func requestScheme(r *http.Request) string {
+	// use explicit scheme
+	if r.URL.Scheme != "" {
+		return strings.ToLower(r.URL.Scheme)
+	}
+
+	// otherwise, infer from connection
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
@@ -1,6 +1,11 @@
 package serve
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -65,3 +70,70 @@ func TestIP(t *testing.T) {
 		assert.Equal(t, item.o, IP(item.i), item)
 	}
 }
+
+func TestInfo(t *testing.T) {
+	handler := Compose(
+		Forwarded(ForwardedConfig{
+			UseFor:       true,
+			UseProto:     true,
+			UseHost:      true,
+			UsePrefix:    true,
+			FakeTLS:      true,
+			AllowedHosts: []string{"*.example.co.uk"},
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(Info(r))
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "http://example.com/foo", nil, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.JSONEq(t, `{
+		"Scheme": "http",
+		"Host": "example.com",
+		"Port": "80",
+		"ClientIP": "192.0.2.1",
+		"BaseURL": "http://example.com",
+		"Secure": false,
+		"Domain": "example.com"
+	}`, r.Body.String())
+
+	r = Record(nil, handler, "GET", "http://internal/foo", map[string]string{
+		"X-Forwarded-For":    "::ffff:1.2.3.4",
+		"X-Forwarded-Proto":  "https",
+		"X-Forwarded-Host":   "www.Example.co.uk:8443",
+		"X-Forwarded-Prefix": "/app",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.JSONEq(t, `{
+		"Scheme": "https",
+		"Host": "www.Example.co.uk",
+		"Port": "8443",
+		"ClientIP": "1.2.3.4",
+		"BaseURL": "https://www.Example.co.uk:8443/app",
+		"Secure": true,
+		"Domain": "example.co.uk"
+	}`, r.Body.String())
+
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Host = "[::1]:8080"
+	req.TLS = &tls.ConnectionState{}
+	assert.Equal(t, RequestInfo{
+		Scheme:   "https",
+		Host:     "::1",
+		Port:     "8080",
+		ClientIP: netip.MustParseAddr("192.0.2.1"),
+		BaseURL:  "https://[::1]:8080",
+		Secure:   true,
+	}, Info(req))
+
+	req = httptest.NewRequest("GET", "/foo", nil)
+	req.Host = "co.uk"
+	assert.Equal(t, RequestInfo{
+		Scheme:   "http",
+		Host:     "co.uk",
+		Port:     "80",
+		ClientIP: netip.MustParseAddr("192.0.2.1"),
+		BaseURL:  "http://co.uk",
+	}, Info(req))
+}
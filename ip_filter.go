@@ -0,0 +1,156 @@
+package serve
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// IPFilterConfig defines the allowed and denied client addresses.
+//
+// Allow and Deny are lists of IPv4 and IPv6 address ranges. AllowFile and
+// DenyFile may name files with additional ranges in the format understood by
+// ParsePrefixes. The files are checked for changes at most once per Reload
+// interval (defaults to five seconds) and reloaded if modified. If a reload
+// fails, the previously loaded ranges remain in use.
+//
+// A request is blocked if the client address is denied, or if Allow or AllowFile
+// is configured and the address is not allowed. Requests with an unknown client
+// address are only blocked in the latter case.
+//
+// The client address is determined using the Resolver, which defaults to the
+// remote address as established by Forwarded. Blocked requests are answered with
+// the configured Status (defaults to 403) and reported to the Reporter if
+// available.
+type IPFilterConfig struct {
+	Allow     []netip.Prefix
+	Deny      []netip.Prefix
+	AllowFile string
+	DenyFile  string
+	Reload    time.Duration
+	Resolver  IPResolver
+	Status    int
+	Reporter  func(r *http.Request, addr netip.Addr)
+}
+
+// IPFilter will return a middleware that blocks requests based on the client
+// IP address. It will panic if a configured file cannot be loaded.
+func IPFilter(config IPFilterConfig) func(http.Handler) http.Handler {
+	// set default reload
+	if config.Reload == 0 {
+		config.Reload = 5 * time.Second
+	}
+
+	// set default status
+	if config.Status == 0 {
+		config.Status = http.StatusForbidden
+	}
+
+	// prepare lists
+	allow := &prefixFile{path: config.AllowFile, reload: config.Reload}
+	deny := &prefixFile{path: config.DenyFile, reload: config.Reload}
+
+	// load lists
+	for _, list := range []*prefixFile{allow, deny} {
+		err := list.load(time.Now())
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// get address
+			addr := ClientIP(r, config.Resolver)
+
+			// get lists
+			now := time.Now()
+			allowed := allow.get(now)
+			denied := deny.get(now)
+
+			// check address
+			blocked := false
+			if len(config.Allow) > 0 || config.AllowFile != "" {
+				blocked = !addr.IsValid() || !(containsAddr(config.Allow, addr) || containsAddr(allowed, addr))
+			}
+			if addr.IsValid() && (containsAddr(config.Deny, addr) || containsAddr(denied, addr)) {
+				blocked = true
+			}
+
+			// handle blocked requests
+			if blocked {
+				if config.Reporter != nil {
+					config.Reporter(r, addr)
+				}
+				w.WriteHeader(config.Status)
+				return
+			}
+
+			// call next
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type prefixFile struct {
+	path     string
+	reload   time.Duration
+	mutex    sync.Mutex
+	prefixes []netip.Prefix
+	modTime  time.Time
+	checked  time.Time
+}
+
+func (f *prefixFile) get(now time.Time) []netip.Prefix {
+	// skip if no file is configured
+	if f.path == "" {
+		return nil
+	}
+
+	// acquire mutex
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// reload if due, keep current ranges on errors
+	if now.Sub(f.checked) >= f.reload {
+		f.checked = now
+		info, err := os.Stat(f.path)
+		if err == nil && !info.ModTime().Equal(f.modTime) {
+			prefixes, err := LoadPrefixes(f.path)
+			if err == nil {
+				f.prefixes = prefixes
+				f.modTime = info.ModTime()
+			}
+		}
+	}
+
+	return f.prefixes
+}
+
+func (f *prefixFile) load(now time.Time) error {
+	// skip if no file is configured
+	if f.path == "" {
+		return nil
+	}
+
+	// get info
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	// load prefixes
+	prefixes, err := LoadPrefixes(f.path)
+	if err != nil {
+		return err
+	}
+
+	// set state
+	f.prefixes = prefixes
+	f.modTime = info.ModTime()
+	f.checked = now
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package serve
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPFilter(t *testing.T) {
+	var reported []string
+	handler := Compose(
+		IPFilter(IPFilterConfig{
+			Allow:    MustPrefixes("192.0.2.0/24, 2001:db8::/32"),
+			Deny:     MustPrefixes("192.0.2.66"),
+			Resolver: RealIPResolver(nil),
+			Status:   http.StatusNotFound,
+			Reporter: func(r *http.Request, addr netip.Addr) {
+				reported = append(reported, addr.String())
+			},
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	matrix := []struct {
+		ip   string
+		code int
+	}{
+		{ip: "192.0.2.1", code: http.StatusOK},
+		{ip: "::ffff:192.0.2.1", code: http.StatusOK},
+		{ip: "2001:db8::1", code: http.StatusOK},
+		{ip: "192.0.2.66", code: http.StatusNotFound},
+		{ip: "1.2.3.4", code: http.StatusNotFound},
+		{ip: "foo", code: http.StatusNotFound},
+	}
+
+	for _, item := range matrix {
+		r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+			"X-Real-IP": item.ip,
+		}, "")
+		assert.Equal(t, item.code, r.Code, item.ip)
+	}
+
+	assert.Equal(t, []string{"192.0.2.66", "1.2.3.4", "invalid IP"}, reported)
+}
+
+func TestIPFilterDenyOnly(t *testing.T) {
+	handler := Compose(
+		IPFilter(IPFilterConfig{
+			Deny: MustPrefixes("192.0.2.0/24"),
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "http://example.com", nil, "")
+	assert.Equal(t, http.StatusForbidden, r.Code)
+}
+
+func TestIPFilterReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "deny.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("# none\n"), 0644))
+
+	handler := Compose(
+		IPFilter(IPFilterConfig{
+			DenyFile: file,
+			Reload:   time.Millisecond,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "http://example.com", nil, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+
+	assert.NoError(t, os.WriteFile(file, []byte("192.0.2.0/24\n"), 0644))
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+	time.Sleep(2 * time.Millisecond)
+
+	r = Record(nil, handler, "GET", "http://example.com", nil, "")
+	assert.Equal(t, http.StatusForbidden, r.Code)
+
+	assert.NoError(t, os.WriteFile(file, []byte("foo\n"), 0644))
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(2*time.Minute)))
+	time.Sleep(2 * time.Millisecond)
+
+	r = Record(nil, handler, "GET", "http://example.com", nil, "")
+	assert.Equal(t, http.StatusForbidden, r.Code)
+
+	assert.Panics(t, func() {
+		IPFilter(IPFilterConfig{
+			AllowFile: filepath.Join(t.TempDir(), "missing.txt"),
+		})
+	})
+}
@@ -1,9 +1,14 @@
 package serve
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 )
 
 // ErrBodyLimitExceeded is returned if a body is read beyond the set limit.
@@ -22,6 +27,165 @@ func Limit(limit int64) func(http.Handler) http.Handler {
 	}
 }
 
+// LimitStrict will return a middleware that ensures a limited body like Limit.
+// Additionally, requests with a declared length beyond the limit are rejected
+// with a "413 Request Entity Too Large" problem response before calling next.
+// As this happens before the body is read, requests that expect a "100
+// Continue" response are refused without sending their body while requests
+// within the limit are continued as usual. If the handler reads beyond the
+// limit without writing a response, the same response is written
+// automatically. In both cases, the connection is closed to avoid draining the
+// remaining body.
+func LimitStrict(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// serve limited
+			serveLimited(w, r, next, limit)
+		})
+	}
+}
+
+// LimitRule defines a body limit for matching requests. Methods is a list of
+// allowed methods and matches all methods if empty. Path and ContentType are
+// patterns as understood by path.Match (e.g. "/upload/*" or "multipart/*") and
+// match all requests if empty. The content type is matched without parameters.
+// Limit is a human-readable byte size as understood by ByteSize.
+type LimitRule struct {
+	Methods     []string
+	Path        string
+	ContentType string
+	Limit       string
+}
+
+// LimitPolicy defines the body limits for requests. The limit of the first
+// matching rule is used, or the Default limit if no rule matches.
+type LimitPolicy struct {
+	Default string
+	Rules   []LimitRule
+}
+
+// LimitWith will return a middleware that limits the body of requests using
+// the provided policy. The selected limit is enforced like in LimitStrict. It
+// will panic if a limit is invalid.
+func LimitWith(policy LimitPolicy) func(http.Handler) http.Handler {
+	// parse limits
+	defaultLimit := MustByteSize(policy.Default)
+	limits := make([]int64, 0, len(policy.Rules))
+	for _, rule := range policy.Rules {
+		limits = append(limits, MustByteSize(rule.Limit))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// get content type
+			contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+			// select limit
+			limit := defaultLimit
+			for i, rule := range policy.Rules {
+				if rule.matches(r, contentType) {
+					limit = limits[i]
+					break
+				}
+			}
+
+			// serve limited
+			serveLimited(w, r, next, limit)
+		})
+	}
+}
+
+func (r LimitRule) matches(req *http.Request, contentType string) bool {
+	// check methods
+	if len(r.Methods) > 0 {
+		found := false
+		for _, method := range r.Methods {
+			if strings.EqualFold(method, req.Method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	// check path
+	if r.Path != "" {
+		if ok, _ := path.Match(r.Path, req.URL.Path); !ok {
+			return false
+		}
+	}
+
+	// check content type
+	if r.ContentType != "" {
+		if ok, _ := path.Match(strings.ToLower(r.ContentType), contentType); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func serveLimited(w http.ResponseWriter, r *http.Request, next http.Handler, limit int64) {
+	// reject oversized requests
+	if r.ContentLength > limit {
+		writeLimitProblem(w, limit)
+		return
+	}
+
+	// limit body
+	LimitBody(w, r, limit)
+
+	// call next
+	lw := &limitWriter{ResponseWriter: w}
+	next.ServeHTTP(lw, r)
+
+	// respond if the limit has been exceeded without a response
+	if bl, ok := r.Body.(*BodyLimiter); ok && bl.Exceeded && !lw.written {
+		writeLimitProblem(w, bl.Limit)
+	}
+}
+
+type limitWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *limitWriter) WriteHeader(statusCode int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *limitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func writeLimitProblem(w http.ResponseWriter, limit int64) {
+	writeTooLargeProblem(w, "request body exceeds limit of "+strconv.FormatInt(limit, 10)+" bytes")
+}
+
+func writeTooLargeProblem(w http.ResponseWriter, detail string) {
+	// encode problem
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":   "about:blank",
+		"title":  http.StatusText(http.StatusRequestEntityTooLarge),
+		"status": http.StatusRequestEntityTooLarge,
+		"detail": detail,
+	})
+
+	// write problem and close connection
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, _ = w.Write(body)
+}
+
 // LimitBody will limit reading from the body of the supplied request to the
 // specified amount of bytes. Earlier calls to LimitBody will be overwritten
 // which essentially allows callers to increase the limit from a default limit
@@ -32,7 +196,16 @@ func LimitBody(w http.ResponseWriter, r *http.Request, limit int64) {
 		r.Body = bl.Original
 	}
 
+	// raise limit of compressed body
+	if db, ok := r.Body.(*decompressBody); ok {
+		db.raise(limit)
+	}
+
 	// set limited body
+	limitBody(w, r, limit)
+}
+
+func limitBody(w http.ResponseWriter, r *http.Request, limit int64) {
 	r.Body = &BodyLimiter{
 		Length:   r.ContentLength,
 		Limit:    limit,
@@ -42,23 +215,27 @@ func LimitBody(w http.ResponseWriter, r *http.Request, limit int64) {
 }
 
 // BodyLimiter wraps an io.ReadCloser and keeps a reference to the original.
+// Exceeded is set when ErrBodyLimitExceeded has been returned.
 type BodyLimiter struct {
 	Length   int64
 	Limit    int64
 	Original io.ReadCloser
 	Limited  io.ReadCloser
+	Exceeded bool
 }
 
 // Read will read from the underlying io.Reader.
 func (l *BodyLimiter) Read(p []byte) (int, error) {
 	// immediately return error if length is beyond limit
 	if l.Length >= 0 && l.Length > l.Limit {
+		l.Exceeded = true
 		return 0, ErrBodyLimitExceeded
 	}
 
 	// read and rewrite error
 	n, err := l.Limited.Read(p)
 	if err != nil && err.Error() == "http: request body too large" {
+		l.Exceeded = true
 		return n, ErrBodyLimitExceeded
 	}
 
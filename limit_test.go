@@ -3,8 +3,10 @@ package serve
 import (
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -69,3 +71,120 @@ func TestLimitBodyWhileReading(t *testing.T) {
 	assert.Equal(t, "Hello", string(bytes))
 	assert.Equal(t, err, ErrBodyLimitExceeded)
 }
+
+func TestLimitWith(t *testing.T) {
+	handler := Compose(
+		LimitWith(LimitPolicy{
+			Default: "10K",
+			Rules: []LimitRule{
+				{
+					Methods:     []string{"POST"},
+					Path:        "/upload",
+					ContentType: "multipart/*",
+					Limit:       "5G",
+				},
+				{
+					ContentType: "application/json",
+					Limit:       "1M",
+				},
+				{
+					Path:  "/small/*",
+					Limit: "1K",
+				},
+			},
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(strconv.FormatInt(r.Body.(*BodyLimiter).Limit, 10)))
+		}),
+	)
+
+	matrix := []struct {
+		method      string
+		path        string
+		contentType string
+		limit       string
+	}{
+		{method: "POST", path: "/upload", contentType: "multipart/form-data; boundary=foo", limit: "5000000000"},
+		{method: "PUT", path: "/upload", contentType: "multipart/form-data; boundary=foo", limit: "10000"},
+		{method: "POST", path: "/upload", contentType: "Application/JSON; charset=utf-8", limit: "1000000"},
+		{method: "POST", path: "/small/foo", contentType: "text/plain", limit: "1000"},
+		{method: "POST", path: "/small/foo/bar", limit: "10000"},
+		{method: "GET", path: "/", limit: "10000"},
+	}
+
+	for _, item := range matrix {
+		r := Record(nil, handler, item.method, item.path, map[string]string{
+			"Content-Type": item.contentType,
+		}, "Hello!")
+		assert.Equal(t, http.StatusOK, r.Code, item)
+		assert.Equal(t, item.limit, r.Body.String(), item)
+	}
+
+	r := Record(nil, handler, "POST", "/small/foo", nil, strings.Repeat("x", 1001))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, r.Code)
+	assert.Equal(t, "application/problem+json", r.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Request Entity Too Large",
+		"status": 413,
+		"detail": "request body exceeds limit of 1000 bytes"
+	}`, r.Body.String())
+
+	assert.Panics(t, func() {
+		LimitWith(LimitPolicy{
+			Default: "10K",
+			Rules: []LimitRule{
+				{Limit: "foo"},
+			},
+		})
+	})
+}
+
+func TestLimitStrict(t *testing.T) {
+	handler := Compose(
+		LimitStrict(10),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = ioutil.ReadAll(r.Body)
+		}),
+	)
+
+	res := Record(nil, handler, "POST", "/", nil, "Hello!")
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = Record(nil, handler, "POST", "/", nil, "Hello World!")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	assert.Equal(t, "close", res.Header().Get("Connection"))
+	assert.Contains(t, res.Body.String(), "request body exceeds limit of 10 bytes")
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("Hello World!"))
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	assert.Equal(t, "close", res.Header().Get("Connection"))
+	assert.True(t, req.Body.(*BodyLimiter).Exceeded)
+}
+
+func TestLimitStrictExpectContinue(t *testing.T) {
+	called := false
+	server := httptest.NewServer(Compose(
+		LimitStrict(10),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}),
+	))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 1000000\r\nExpect: 100-continue\r\n\r\n"))
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 413 Request Entity Too Large\r\n"), string(data))
+	assert.NotContains(t, string(data), "100 Continue")
+	assert.False(t, called)
+}
@@ -0,0 +1,251 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// ErrMultipartLimitExceeded is returned if a multipart body exceeds the part
+// count or size limits.
+var ErrMultipartLimitExceeded = errors.New("multipart limit exceeded")
+
+// LimitsConfig defines the limits enforced by Limits. Zero values disable the
+// respective limit. Sizes are human-readable byte sizes as understood by
+// ByteSize.
+//
+// The header limits count all header values and the bytes of all header keys
+// and values. The URL limits apply to the request URI and the number of query
+// parameters. The multipart limits are enforced by the reader returned from
+// MultipartReader and apply to the number of parts, the size of each part and
+// the total size of all parts. Parts that are skipped without being read fully
+// are drained and counted towards the limits.
+type LimitsConfig struct {
+	MaxHeaderCount   int
+	MaxHeaderSize    string
+	MaxURLLength     int
+	MaxQueryParams   int
+	MaxParts         int
+	MaxPartSize      string
+	MaxMultipartSize string
+}
+
+type multipartLimits struct {
+	parts     int
+	partSize  int64
+	totalSize int64
+}
+
+type multipartState struct {
+	limits   *multipartLimits
+	exceeded bool
+}
+
+type limitsKey struct{}
+
+// Limits will return a middleware that enforces the configured limits. Requests
+// with too many or too large headers are rejected with "431 Request Header
+// Fields Too Large" and requests with a too long URL or too many query
+// parameters with "414 Request URI Too Long". If the handler reads beyond the
+// multipart limits without writing a response, a "413 Request Entity Too Large"
+// problem response is written automatically. It will panic if a size is
+// invalid.
+func Limits(config LimitsConfig) func(http.Handler) http.Handler {
+	// parse sizes
+	parse := func(str string) int64 {
+		if str == "" {
+			return 0
+		}
+		return MustByteSize(str)
+	}
+	maxHeaderSize := parse(config.MaxHeaderSize)
+	limits := &multipartLimits{
+		parts:     config.MaxParts,
+		partSize:  parse(config.MaxPartSize),
+		totalSize: parse(config.MaxMultipartSize),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// check headers
+			if config.MaxHeaderCount > 0 || maxHeaderSize > 0 {
+				var count int
+				var size int64
+				for key, values := range r.Header {
+					for _, value := range values {
+						count++
+						size += int64(len(key) + len(value))
+					}
+				}
+				if (config.MaxHeaderCount > 0 && count > config.MaxHeaderCount) || (maxHeaderSize > 0 && size > maxHeaderSize) {
+					w.WriteHeader(http.StatusRequestHeaderFieldsTooLarge)
+					return
+				}
+			}
+
+			// check URL length
+			if config.MaxURLLength > 0 {
+				uri := r.RequestURI
+				if uri == "" {
+					uri = r.URL.RequestURI()
+				}
+				if len(uri) > config.MaxURLLength {
+					w.WriteHeader(http.StatusRequestURITooLong)
+					return
+				}
+			}
+
+			// check query parameters
+			if config.MaxQueryParams > 0 {
+				var count int
+				for _, param := range strings.Split(r.URL.RawQuery, "&") {
+					if param != "" {
+						count++
+					}
+				}
+				if count > config.MaxQueryParams {
+					w.WriteHeader(http.StatusRequestURITooLong)
+					return
+				}
+			}
+
+			// store multipart limits
+			state := &multipartState{limits: limits}
+			r = r.WithContext(context.WithValue(r.Context(), limitsKey{}, state))
+
+			// call next
+			lw := &limitWriter{ResponseWriter: w}
+			next.ServeHTTP(lw, r)
+
+			// respond if the limits have been exceeded without a response
+			if state.exceeded && !lw.written {
+				writeTooLargeProblem(w, "multipart body exceeds limits")
+			}
+		})
+	}
+}
+
+// MultipartReader returns a streaming multipart reader for the request body
+// that enforces the multipart limits configured using Limits. Reads beyond the
+// limits return ErrMultipartLimitExceeded and cause Limits to respond with "413
+// Request Entity Too Large" if the handler does not write a response. No limits
+// are enforced if Limits was not used.
+func MultipartReader(r *http.Request) (*LimitedMultipartReader, error) {
+	// get reader
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	// get state
+	state, _ := r.Context().Value(limitsKey{}).(*multipartState)
+	if state == nil {
+		state = &multipartState{limits: &multipartLimits{}}
+	}
+
+	return &LimitedMultipartReader{
+		reader: reader,
+		state:  state,
+	}, nil
+}
+
+// LimitedMultipartReader wraps a multipart.Reader and enforces part limits.
+type LimitedMultipartReader struct {
+	reader  *multipart.Reader
+	state   *multipartState
+	current *LimitedPart
+	parts   int
+	total   int64
+}
+
+// NextPart returns the next part or io.EOF if there are no more parts. It
+// returns ErrMultipartLimitExceeded if a limit has been exceeded.
+func (r *LimitedMultipartReader) NextPart() (*LimitedPart, error) {
+	// check state
+	if r.state.exceeded {
+		return nil, ErrMultipartLimitExceeded
+	}
+
+	// drain current part to count skipped bytes
+	if r.current != nil {
+		_, err := io.Copy(io.Discard, r.current)
+		if err != nil {
+			return nil, err
+		}
+		r.current = nil
+	}
+
+	// check for additional parts if the count limit has been reached
+	if r.state.limits.parts > 0 && r.parts >= r.state.limits.parts {
+		_, err := r.reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		r.state.exceeded = true
+		return nil, ErrMultipartLimitExceeded
+	}
+
+	// get part
+	part, err := r.reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+
+	// increment
+	r.parts++
+
+	// set current
+	r.current = &LimitedPart{
+		Part:   part,
+		reader: r,
+	}
+
+	return r.current, nil
+}
+
+// LimitedPart wraps a multipart.Part and enforces the size limits.
+type LimitedPart struct {
+	*multipart.Part
+	reader *LimitedMultipartReader
+	size   int64
+}
+
+// Read will read from the underlying part.
+func (p *LimitedPart) Read(b []byte) (int, error) {
+	// check state
+	state := p.reader.state
+	if state.exceeded {
+		return 0, ErrMultipartLimitExceeded
+	}
+
+	// get remaining allowance
+	remaining := int64(-1)
+	if state.limits.partSize > 0 {
+		remaining = state.limits.partSize - p.size
+	}
+	if state.limits.totalSize > 0 && (remaining < 0 || state.limits.totalSize-p.reader.total < remaining) {
+		remaining = state.limits.totalSize - p.reader.total
+	}
+
+	// read at most one byte beyond the allowance
+	if remaining >= 0 && int64(len(b)) > remaining+1 {
+		b = b[:remaining+1]
+	}
+	n, err := p.Part.Read(b)
+
+	// check allowance
+	if remaining >= 0 && int64(n) > remaining {
+		n = int(remaining)
+		err = ErrMultipartLimitExceeded
+		state.exceeded = true
+	}
+
+	// increment
+	p.size += int64(n)
+	p.reader.total += int64(n)
+
+	return n, err
+}
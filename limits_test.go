@@ -0,0 +1,178 @@
+package serve
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	handler := Compose(
+		Limits(LimitsConfig{
+			MaxHeaderCount: 3,
+			MaxHeaderSize:  "1K",
+			MaxURLLength:   20,
+			MaxQueryParams: 2,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	r := Record(nil, handler, "GET", "/foo?a=1&b=2", map[string]string{
+		"X-Foo": "bar",
+	}, "")
+	assert.Equal(t, http.StatusOK, r.Code)
+
+	r = Record(nil, handler, "GET", "/foo", map[string]string{
+		"X-A": "1",
+		"X-B": "2",
+		"X-C": "3",
+		"X-D": "4",
+	}, "")
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, r.Code)
+
+	r = Record(nil, handler, "GET", "/foo", map[string]string{
+		"X-Foo": strings.Repeat("x", 1000),
+	}, "")
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, r.Code)
+
+	r = Record(nil, handler, "GET", "/"+strings.Repeat("x", 20), nil, "")
+	assert.Equal(t, http.StatusRequestURITooLong, r.Code)
+
+	r = Record(nil, handler, "GET", "/foo?a=1&b=2&c=3", nil, "")
+	assert.Equal(t, http.StatusRequestURITooLong, r.Code)
+}
+
+func TestLimitsMultipart(t *testing.T) {
+	consume := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := MultipartReader(r)
+		assert.NoError(t, err)
+
+		var names []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			} else if err == ErrMultipartLimitExceeded {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			assert.NoError(t, err)
+
+			_, err = io.Copy(io.Discard, part)
+			if err == ErrMultipartLimitExceeded {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			assert.NoError(t, err)
+
+			names = append(names, part.FormName())
+		}
+
+		_, _ = w.Write([]byte(strings.Join(names, ",")))
+	})
+
+	handler := Compose(
+		Limits(LimitsConfig{
+			MaxParts:         2,
+			MaxPartSize:      "1K",
+			MaxMultipartSize: "2K",
+		}),
+		consume,
+	)
+
+	matrix := []struct {
+		parts []int
+		code  int
+	}{
+		{parts: []int{10, 1000}, code: http.StatusOK},
+		{parts: []int{10, 10, 10}, code: http.StatusRequestEntityTooLarge},
+		{parts: []int{1001}, code: http.StatusRequestEntityTooLarge},
+		{parts: []int{1000, 1000}, code: http.StatusOK},
+	}
+
+	for _, item := range matrix {
+		body, contentType := multipartBody(t, item.parts)
+		r := Record(nil, handler, "POST", "/", map[string]string{
+			"Content-Type": contentType,
+		}, body)
+		assert.Equal(t, item.code, r.Code, item.parts)
+	}
+
+	handler = Compose(
+		Limits(LimitsConfig{
+			MaxMultipartSize: "1K",
+		}),
+		consume,
+	)
+
+	body, contentType := multipartBody(t, []int{600, 600})
+	r := Record(nil, handler, "POST", "/", map[string]string{
+		"Content-Type": contentType,
+	}, body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, r.Code)
+
+	var sizes []int
+	handler = Compose(
+		Limits(LimitsConfig{
+			MaxPartSize:      "1K",
+			MaxMultipartSize: "1K",
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reader, err := MultipartReader(r)
+			assert.NoError(t, err)
+
+			for {
+				part, err := reader.NextPart()
+				if err != nil {
+					return
+				}
+				if part.FormName() == "a" && r.URL.Path == "/skip" {
+					continue
+				}
+				data, err := io.ReadAll(part)
+				sizes = append(sizes, len(data))
+				if err != nil {
+					assert.Equal(t, ErrMultipartLimitExceeded, err)
+					return
+				}
+			}
+		}),
+	)
+
+	body, contentType = multipartBody(t, []int{1500})
+	r = Record(nil, handler, "POST", "/", map[string]string{
+		"Content-Type": contentType,
+	}, body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, r.Code)
+	assert.Equal(t, "application/problem+json", r.Header().Get("Content-Type"))
+	assert.Equal(t, []int{1000}, sizes)
+
+	sizes = nil
+	body, contentType = multipartBody(t, []int{600, 600})
+	r = Record(nil, handler, "POST", "/skip", map[string]string{
+		"Content-Type": contentType,
+	}, body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, r.Code)
+	assert.Equal(t, []int{400}, sizes)
+}
+
+func multipartBody(t *testing.T, parts []int) (string, string) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for i, size := range parts {
+		part, err := writer.CreateFormField(string(rune('a' + i)))
+		assert.NoError(t, err)
+		_, err = part.Write(bytes.Repeat([]byte("x"), size))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+
+	return buf.String(), writer.FormDataContentType()
+}
@@ -1,8 +1,18 @@
 package serve
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type local struct {
@@ -10,17 +20,302 @@ type local struct {
 }
 
 func (l *local) RoundTrip(req *http.Request) (*http.Response, error) {
-	// prepare recorder
-	rec := httptest.NewRecorder()
+	// prepare context that is cancelled with the client request or when the
+	// response body is closed
+	ctx, cancel := context.WithCancel(req.Context())
+
+	// prepare server request
+	sreq := localRequest(ctx, req)
+
+	// prepare pipe and writer
+	pr, pw := io.Pipe()
+	w := &localWriter{
+		req:     req,
+		header:  http.Header{},
+		pipe:    pw,
+		trace:   httptrace.ContextClientTrace(req.Context()),
+		headers: make(chan *http.Response, 1),
+		tls:     sreq.TLS,
+		body:    &localBody{reader: pr, ctx: req.Context(), cancel: cancel},
+	}
+
+	// abort response body when the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		_ = pr.CloseWithError(ctx.Err())
+	})
 
 	// serve request
-	l.handler.ServeHTTP(rec, req)
+	go func() {
+		// release context
+		defer cancel()
+		defer stop()
+
+		// close request body
+		if req.Body != nil {
+			defer req.Body.Close()
+		}
 
-	return rec.Result(), nil
+		// finish response or report panic
+		defer func() {
+			if v := recover(); v != nil {
+				w.finish(fmt.Errorf("serve: handler panicked: %v", v))
+				return
+			}
+			w.finish(nil)
+		}()
+
+		// call handler
+		l.handler.ServeHTTP(w, sreq)
+	}()
+
+	// await response
+	select {
+	case res := <-w.headers:
+		if res == nil {
+			cancel()
+			return nil, w.err
+		}
+		return res, nil
+	case <-req.Context().Done():
+		cancel()
+		return nil, req.Context().Err()
+	}
 }
 
 // Local returns a round tripper that uses the provided handler to serve the
 // requests. It may be used with http.Client in unit tests.
+//
+// The handler is run in a separate goroutine and the response body is streamed
+// to the client as it is written. The handler supports http.Flusher, trailers
+// and informational responses which are reported using httptrace. The request
+// context is cancelled when the client request is cancelled or the response
+// body is closed. The remote address is set to a loopback address and "https"
+// requests receive a TLS connection state.
 func Local(handler http.Handler) http.RoundTripper {
 	return &local{handler: handler}
 }
+
+func localRequest(ctx context.Context, req *http.Request) *http.Request {
+	// clone request
+	sreq := req.Clone(ctx)
+
+	// set server fields
+	sreq.RequestURI = req.URL.RequestURI()
+	sreq.URL = &url.URL{
+		Path:     req.URL.Path,
+		RawPath:  req.URL.RawPath,
+		RawQuery: req.URL.RawQuery,
+	}
+	sreq.Proto, sreq.ProtoMajor, sreq.ProtoMinor = "HTTP/1.1", 1, 1
+	sreq.RemoteAddr = "127.0.0.1:1234"
+	if sreq.Host == "" {
+		sreq.Host = req.URL.Host
+	}
+
+	// set body
+	sreq.Body = req.Body
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+
+	// set tls
+	if req.URL.Scheme == "https" {
+		sreq.TLS = &tls.ConnectionState{
+			Version:           tls.VersionTLS13,
+			HandshakeComplete: true,
+			CipherSuite:       tls.TLS_AES_128_GCM_SHA256,
+			ServerName:        Hostname(sreq.Host),
+		}
+	}
+
+	return sreq
+}
+
+type localWriter struct {
+	req     *http.Request
+	header  http.Header
+	pipe    *io.PipeWriter
+	trace   *httptrace.ClientTrace
+	tls     *tls.ConnectionState
+	headers chan *http.Response
+	body    *localBody
+	res     *http.Response
+	err     error
+	mutex   sync.Mutex
+}
+
+func (w *localWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *localWriter) WriteHeader(statusCode int) {
+	// acquire mutex
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// write header
+	w.writeHeader(statusCode, nil)
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	// write header
+	w.mutex.Lock()
+	w.writeHeader(http.StatusOK, p)
+	w.mutex.Unlock()
+
+	// discard body for HEAD requests
+	if w.req.Method == http.MethodHead {
+		return len(p), nil
+	}
+
+	// skip body if not allowed
+	if !bodyAllowed(w.req.Method, w.res.StatusCode) {
+		return 0, http.ErrBodyNotAllowed
+	}
+
+	return w.pipe.Write(p)
+}
+
+func (w *localWriter) Flush() {
+	// acquire mutex
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// write header
+	w.writeHeader(http.StatusOK, nil)
+}
+
+func (w *localWriter) writeHeader(statusCode int, data []byte) {
+	// skip if already written
+	if w.res != nil {
+		return
+	}
+
+	// handle informational responses
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		if w.trace != nil && w.trace.Got1xxResponse != nil {
+			_ = w.trace.Got1xxResponse(statusCode, textproto.MIMEHeader(w.header.Clone()))
+		}
+		return
+	}
+
+	// detect content type
+	if data != nil && w.header.Get("Content-Type") == "" && w.header.Get("Content-Encoding") == "" {
+		w.header.Set("Content-Type", http.DetectContentType(data))
+	}
+
+	// get content length
+	contentLength := int64(-1)
+	if n, err := strconv.ParseInt(w.header.Get("Content-Length"), 10, 64); err == nil {
+		contentLength = n
+	}
+
+	// prepare trailer
+	var trailer http.Header
+	for _, value := range w.header.Values("Trailer") {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				if trailer == nil {
+					trailer = http.Header{}
+				}
+				trailer[http.CanonicalHeaderKey(key)] = nil
+			}
+		}
+	}
+
+	// prepare response
+	w.res = &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header.Clone(),
+		Body:          w.body,
+		ContentLength: contentLength,
+		Trailer:       trailer,
+		Request:       w.req,
+		TLS:           w.tls,
+	}
+	w.res.Header.Del("Trailer")
+	if !bodyAllowed(w.req.Method, statusCode) {
+		w.res.Body = http.NoBody
+	}
+
+	// send response
+	w.headers <- w.res
+}
+
+func (w *localWriter) finish(err error) {
+	// acquire mutex
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// report error if response has not been sent
+	if err != nil && w.res == nil {
+		w.err = err
+		w.headers <- nil
+		_ = w.pipe.CloseWithError(err)
+		return
+	}
+
+	// ensure response
+	w.writeHeader(http.StatusOK, nil)
+
+	// set trailers
+	for key, values := range w.header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			if w.res.Trailer == nil {
+				w.res.Trailer = http.Header{}
+			}
+			w.res.Trailer[http.CanonicalHeaderKey(strings.TrimPrefix(key, http.TrailerPrefix))] = values
+		} else if _, ok := w.res.Trailer[key]; ok {
+			w.res.Trailer[key] = values
+		}
+	}
+
+	// close pipe, the body may be incomplete if the request was cancelled
+	if err == nil {
+		err = w.req.Context().Err()
+	}
+	if err != nil {
+		_ = w.pipe.CloseWithError(err)
+	} else {
+		_ = w.pipe.Close()
+	}
+}
+
+type localBody struct {
+	reader *io.PipeReader
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (b *localBody) Read(p []byte) (int, error) {
+	// read and report cancellation
+	n, err := b.reader.Read(p)
+	if err == io.ErrClosedPipe && b.ctx.Err() != nil {
+		return n, b.ctx.Err()
+	}
+
+	return n, err
+}
+
+func (b *localBody) Close() error {
+	b.cancel()
+	return b.reader.CloseWithError(errors.New("serve: response body closed"))
+}
+
+func bodyAllowed(method string, status int) bool {
+	// check method
+	if method == http.MethodHead {
+		return false
+	}
+
+	// check status
+	if (status >= 100 && status <= 199) || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	return true
+}
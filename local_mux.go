@@ -0,0 +1,111 @@
+package serve
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrLocalNetwork may be used as a LocalRoute error to simulate network errors.
+var ErrLocalNetwork = errors.New("serve: simulated network error")
+
+// LocalRoute defines how requests to a host are served by a LocalMux.
+//
+// Latency delays each request before it is served. If Refuse is set or the
+// Handler is absent, requests fail with a "connection refused" error and if
+// Error is set, requests fail with the provided error instead.
+type LocalRoute struct {
+	Handler http.Handler
+	Latency time.Duration
+	Refuse  bool
+	Error   error
+}
+
+// LocalMux is a round tripper that dispatches requests by host to handlers
+// that are served using Local. Routes are keyed by "scheme://host:port",
+// "scheme://host", "host:port" or "host" and are matched in that order.
+// The port defaults to the default port of the scheme. Requests to unknown
+// hosts are passed to the Fallback round tripper or fail with a "no such host"
+// error if absent. It may be used with http.Client in integration tests.
+type LocalMux struct {
+	Routes   map[string]LocalRoute
+	Fallback http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (m *LocalMux) RoundTrip(req *http.Request) (*http.Response, error) {
+	// get scheme, host and port
+	scheme := req.URL.Scheme
+	host := req.URL.Hostname()
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if scheme == "https" {
+			port = "443"
+		}
+	}
+	hostPort := net.JoinHostPort(host, port)
+
+	// find route
+	var route LocalRoute
+	var ok bool
+	for _, key := range []string{scheme + "://" + hostPort, scheme + "://" + host, hostPort, host} {
+		route, ok = m.Routes[key]
+		if ok {
+			break
+		}
+	}
+
+	// handle unknown hosts
+	if !ok {
+		// use fallback
+		if m.Fallback != nil {
+			return m.Fallback.RoundTrip(req)
+		}
+
+		// close body
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{
+			Err:        "no such host",
+			Name:       host,
+			IsNotFound: true,
+		}}
+	}
+
+	// simulate latency
+	if route.Latency > 0 {
+		timer := time.NewTimer(route.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			if req.Body != nil {
+				_ = req.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+	}
+
+	// simulate errors
+	if route.Refuse || route.Error != nil || route.Handler == nil {
+		// close body
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+
+		// return error
+		if route.Error != nil {
+			return nil, route.Error
+		}
+
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	}
+
+	return Local(route.Handler).RoundTrip(req)
+}
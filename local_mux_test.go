@@ -0,0 +1,90 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalMux(t *testing.T) {
+	reply := func(str string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(str))
+		})
+	}
+
+	client := http.Client{
+		Transport: &LocalMux{
+			Routes: map[string]LocalRoute{
+				"api.example.com":            {Handler: reply("api")},
+				"api.example.com:8080":       {Handler: reply("api:8080")},
+				"https://api.example.com":    {Handler: reply("https-api")},
+				"http://api.example.com:443": {Handler: reply("http-api:443")},
+				"slow.example.com":           {Handler: reply("slow"), Latency: 10 * time.Millisecond},
+				"down.example.com":           {Refuse: true},
+				"flaky.example.com":          {Handler: reply("flaky"), Error: ErrLocalNetwork},
+			},
+			Fallback: Local(reply("fallback")),
+		},
+	}
+
+	get := func(url string) (string, error) {
+		res, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		return string(data), err
+	}
+
+	matrix := []struct {
+		url  string
+		body string
+	}{
+		{url: "http://api.example.com", body: "api"},
+		{url: "http://api.example.com:80/foo", body: "api"},
+		{url: "http://api.example.com:8080", body: "api:8080"},
+		{url: "https://api.example.com", body: "https-api"},
+		{url: "https://api.example.com:8080", body: "https-api"},
+		{url: "http://api.example.com:443", body: "http-api:443"},
+		{url: "http://other.example.com", body: "fallback"},
+	}
+
+	for _, item := range matrix {
+		body, err := get(item.url)
+		assert.NoError(t, err, item.url)
+		assert.Equal(t, item.body, body, item.url)
+	}
+
+	start := time.Now()
+	body, err := get("http://slow.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", body)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+
+	_, err = get("http://down.example.com")
+	assert.True(t, errors.Is(err, syscall.ECONNREFUSED), err)
+
+	_, err = get("http://flaky.example.com")
+	assert.True(t, errors.Is(err, ErrLocalNetwork), err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://slow.example.com", nil)
+	assert.NoError(t, err)
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+
+	_, err = (&LocalMux{}).RoundTrip(req)
+	var dnsErr *net.DNSError
+	assert.True(t, errors.As(err, &dnsErr))
+	assert.True(t, dnsErr.IsNotFound)
+}
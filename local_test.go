@@ -1,8 +1,13 @@
 package serve
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,3 +30,153 @@ func TestLocal(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "OK!", string(data))
 }
+
+func TestLocalStreaming(t *testing.T) {
+	step := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "127.0.0.1:1234", r.RemoteAddr)
+		assert.Equal(t, "example.com", r.Host)
+		assert.Equal(t, "/foo?bar=baz", r.RequestURI)
+		assert.NotNil(t, r.TLS)
+
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("Hello"))
+		w.(http.Flusher).Flush()
+		<-step
+		_, _ = w.Write([]byte(" World!"))
+		w.Header().Set("X-Checksum", "123")
+		w.Header().Set(http.TrailerPrefix+"X-Extra", "456")
+	})
+
+	client := http.Client{
+		Transport: Local(handler),
+	}
+
+	res, err := client.Get("https://example.com/foo?bar=baz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.NotNil(t, res.TLS)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(res.Body, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", string(buf))
+
+	close(step)
+
+	data, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, " World!", string(data))
+	assert.Equal(t, http.Header{
+		"X-Checksum": []string{"123"},
+		"X-Extra":    []string{"456"},
+	}, res.Trailer)
+	assert.NoError(t, res.Body.Close())
+}
+
+func TestLocalInformational(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		_, _ = w.Write([]byte("OK!"))
+	})
+
+	var codes []int
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			codes = append(codes, code)
+			assert.Equal(t, "</style.css>; rel=preload", header.Get("Link"))
+			return nil
+		},
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://example.com", nil)
+	assert.NoError(t, err)
+
+	res, err := Local(handler).RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "", res.Header.Get("Link"))
+	assert.Equal(t, []int{http.StatusEarlyHints}, codes)
+
+	data, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "OK!", string(data))
+}
+
+func TestLocalCancellation(t *testing.T) {
+	done := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		done <- r.Context().Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://example.com", nil)
+	assert.NoError(t, err)
+
+	res, err := Local(handler).RoundTrip(req)
+	assert.NoError(t, err)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	_, err = ioutil.ReadAll(res.Body)
+	assert.Equal(t, context.Canceled, err)
+
+	res, err = Local(handler).RoundTrip(req)
+	assert.Nil(t, res)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, <-done)
+
+	req, err = http.NewRequest("GET", "http://example.com", nil)
+	assert.NoError(t, err)
+
+	res, err = Local(handler).RoundTrip(req)
+	assert.NoError(t, err)
+	assert.NoError(t, res.Body.Close())
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestLocalPanic(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("foo")
+	})
+
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	assert.NoError(t, err)
+
+	res, err := Local(handler).RoundTrip(req)
+	assert.Nil(t, res)
+	assert.EqualError(t, err, "serve: handler panicked: foo")
+}
+
+func TestLocalBodyNotAllowed(t *testing.T) {
+	results := make(chan string, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		n, err := w.Write([]byte("OK!"))
+		results <- fmt.Sprintf("%d %v", n, err)
+	})
+
+	client := http.Client{
+		Transport: Local(handler),
+	}
+
+	res, err := client.Head("http://example.com/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.NoError(t, res.Body.Close())
+	assert.Equal(t, "3 <nil>", <-results)
+
+	res, err = client.Get("http://example.com/empty")
+	assert.NoError(t, err)
+	assert.Equal(t, 204, res.StatusCode)
+	assert.NoError(t, res.Body.Close())
+	assert.Equal(t, "0 "+http.ErrBodyNotAllowed.Error(), <-results)
+}
@@ -0,0 +1,105 @@
+package serve
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryListener is an in-memory net.Listener that accepts connections created
+// by its dialer using net.Pipe. It may be used to run a real http.Server in
+// tests without opening ports. Connections report loopback addresses with the
+// listener using port 80 and dialed connections using increasing ports.
+type MemoryListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	ports atomic.Int32
+	addr  *net.TCPAddr
+}
+
+// NewMemoryListener creates and returns a new MemoryListener.
+func NewMemoryListener() *MemoryListener {
+	return &MemoryListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		addr:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80},
+	}
+}
+
+// Accept waits for and returns the next dialed connection.
+func (l *MemoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener. Dialing will fail afterward, but existing
+// connections are not closed.
+func (l *MemoryListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// Addr returns the listener address.
+func (l *MemoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// Dial creates a connection to the listener.
+func (l *MemoryListener) Dial() (net.Conn, error) {
+	return l.DialContext(context.Background(), "tcp", l.addr.String())
+}
+
+// DialContext creates a connection to the listener. The network and address
+// are ignored. It may be used as the http.Transport DialContext function.
+func (l *MemoryListener) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	// create pipe
+	client, server := net.Pipe()
+
+	// prepare addresses
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1024 + int(l.ports.Add(1))}
+
+	// hand over connection
+	select {
+	case l.conns <- &memoryConn{Conn: server, local: l.addr, remote: remote}:
+		return &memoryConn{Conn: client, local: remote, remote: l.addr}, nil
+	case <-l.done:
+		_ = client.Close()
+		_ = server.Close()
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Addr: l.addr, Err: net.ErrClosed}
+	case <-ctx.Done():
+		_ = client.Close()
+		_ = server.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Transport returns a http.Transport that dials all connections to the
+// listener.
+func (l *MemoryListener) Transport() *http.Transport {
+	return &http.Transport{
+		DialContext: l.DialContext,
+	}
+}
+
+type memoryConn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *memoryConn) RemoteAddr() net.Addr {
+	return c.remote
+}
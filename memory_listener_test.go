@@ -0,0 +1,71 @@
+package serve
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryListener(t *testing.T) {
+	listener := NewMemoryListener()
+
+	var mutex sync.Mutex
+	var states []http.ConnState
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr + " " + r.Host))
+		}),
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			mutex.Lock()
+			states = append(states, state)
+			mutex.Unlock()
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = server.Serve(listener)
+		close(done)
+	}()
+
+	transport := listener.Transport()
+	client := http.Client{
+		Transport: transport,
+	}
+
+	res, err := client.Get("http://example.com/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	data, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, res.Body.Close())
+	assert.Equal(t, "127.0.0.1:1025 example.com", string(data))
+
+	res, err = client.Get("http://example.com/bar")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NoError(t, res.Body.Close())
+
+	transport.CloseIdleConnections()
+	assert.NoError(t, server.Close())
+	<-done
+
+	mutex.Lock()
+	assert.Contains(t, states, http.StateNew)
+	assert.Contains(t, states, http.StateActive)
+	mutex.Unlock()
+
+	_, err = listener.Dial()
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = NewMemoryListener().DialContext(ctx, "tcp", "")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
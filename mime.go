@@ -16,8 +16,8 @@ import (
 var mimeJSON []byte
 
 var mimeOnce sync.Once
-var mimeDB = map[string]mimeEntry{}
-var mimeExt = map[string][]mimeEntry{}
+var mimeDB = map[string]MimeType{}
+var mimeExt = map[string][]MimeType{}
 
 var mimeSources = map[string]int{
 	"nginx":  0,
@@ -26,12 +26,18 @@ var mimeSources = map[string]int{
 	"iana":   3,
 }
 
-type mimeEntry struct {
-	Name            string   `json:"-"`
-	NameWithCharset string   `json:"-"`
-	Source          string   `json:"source"`
-	Compressible    bool     `json:"compressible"`
-	Extensions      []string `json:"extensions"`
+// MimeType describes a MIME type from the embedded database. Extensions begin
+// with a leading dot and Source is one of "iana", "apache", "nginx" or empty.
+// Charset is the default charset if one is defined. The Extensions slice is
+// shared and must not be modified.
+type MimeType struct {
+	Name         string   `json:"-"`
+	Extensions   []string `json:"extensions"`
+	Compressible bool     `json:"compressible"`
+	Source       string   `json:"source"`
+	Charset      string   `json:"charset"`
+
+	nameWithCharset string
 }
 
 func initMime() {
@@ -49,7 +55,7 @@ func initMime() {
 
 			// add name with charset
 			if strings.HasPrefix(name, "text/") {
-				entry.NameWithCharset = name + "; charset=utf-8"
+				entry.nameWithCharset = name + "; charset=utf-8"
 			}
 
 			// add dot prefix
@@ -57,6 +63,9 @@ func initMime() {
 				entry.Extensions[i] = "." + ext
 			}
 
+			// store entry
+			mimeDB[name] = entry
+
 			// store by extensions
 			for _, ext := range entry.Extensions {
 				mimeExt[ext] = append(mimeExt[ext], entry)
@@ -78,30 +87,90 @@ func initMime() {
 //
 // Note: It will prefer a static DB over the builtin mime package.
 func MimeTypeByExtension(ext string, withCharset bool) string {
+	// check table
+	name := lookupMimeType(ext, withCharset)
+	if name != "" {
+		return name
+	}
+
+	// check builtin
+	name = mime.TypeByExtension(strings.ToLower(ext))
+	if withCharset && strings.HasPrefix(name, "text/") && !strings.Contains(name, "charset=") {
+		name += "; charset=utf-8"
+	}
+
+	return name
+}
+
+func lookupMimeType(ext string, withCharset bool) string {
 	// initialize
 	initMime()
 
-	// lower case
-	ext = strings.ToLower(ext)
-
 	// check table
-	var name string
-	entries, ok := mimeExt[ext]
-	if ok {
-		name = entries[0].Name
-		if withCharset && entries[0].NameWithCharset != "" {
-			name = entries[0].NameWithCharset
-		}
-	} else {
-		name = mime.TypeByExtension(ext)
-		if withCharset && strings.HasPrefix(name, "text/") && !strings.Contains(name, "charset=") {
-			name += "; charset=utf-8"
-		}
+	entries, ok := mimeExt[strings.ToLower(ext)]
+	if !ok {
+		return ""
+	}
+
+	// get name
+	name := entries[0].Name
+	if withCharset && entries[0].nameWithCharset != "" {
+		name = entries[0].nameWithCharset
 	}
 
 	return name
 }
 
+// MimeTypeForExtension returns the MIME type from the embedded database that is
+// associated with the provided file extension. The extension ext should begin
+// with a leading dot. If multiple types are associated with the extension, the
+// type from the most preferred source is returned.
+func MimeTypeForExtension(ext string) (MimeType, bool) {
+	// initialize
+	initMime()
+
+	// check table
+	entries, ok := mimeExt[strings.ToLower(ext)]
+	if !ok {
+		return MimeType{}, false
+	}
+
+	return entries[0], true
+}
+
+// MimeTypeForName returns the MIME type from the embedded database with the
+// provided name. Parameters (e.g. "; charset=utf-8") are ignored.
+func MimeTypeForName(name string) (MimeType, bool) {
+	// initialize
+	initMime()
+
+	// remove parameters
+	name, _, _ = strings.Cut(name, ";")
+
+	// check table
+	entry, ok := mimeDB[strings.ToLower(strings.TrimSpace(name))]
+
+	return entry, ok
+}
+
+// MimeTypeForFile returns the MIME type from the embedded database that is
+// associated with the extension of the provided file name. Both slashes and
+// backslashes are treated as path separators.
+func MimeTypeForFile(filename string) (MimeType, bool) {
+	// get base name
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+
+	// get extension
+	i := strings.LastIndexByte(filename, '.')
+	if i < 0 {
+		return MimeType{}, false
+	}
+
+	return MimeTypeForExtension(filename[i:])
+}
+
 // ExtensionsByMimeType returns the extensions known to be associated with the
 // provided MIME type. The returned extensions will each begin with a leading dot.
 // When typ has no associated extensions, it returns a nil slice.
@@ -113,3 +113,52 @@ func BenchmarkExtensionsByMimeType(b *testing.B) {
 		}
 	}
 }
+
+func TestMimeTypeForExtension(t *testing.T) {
+	typ, ok := MimeTypeForExtension(".JSON")
+	assert.True(t, ok)
+	assert.Equal(t, MimeType{
+		Name:         "application/json",
+		Extensions:   []string{".json", ".map"},
+		Compressible: true,
+		Source:       "iana",
+		Charset:      "UTF-8",
+	}, typ)
+
+	typ, ok = MimeTypeForExtension(".png")
+	assert.True(t, ok)
+	assert.Equal(t, "image/png", typ.Name)
+	assert.False(t, typ.Compressible)
+
+	_, ok = MimeTypeForExtension(".foo-bar")
+	assert.False(t, ok)
+}
+
+func TestMimeTypeForName(t *testing.T) {
+	typ, ok := MimeTypeForName("Text/HTML; charset=utf-8")
+	assert.True(t, ok)
+	assert.Equal(t, "text/html", typ.Name)
+	assert.True(t, typ.Compressible)
+	assert.Equal(t, ".html", typ.Extensions[0])
+
+	_, ok = MimeTypeForName("foo/bar")
+	assert.False(t, ok)
+}
+
+func TestMimeTypeForFile(t *testing.T) {
+	for ext, name := range testMimeTypes {
+		typ, ok := MimeTypeForFile("/foo/bar" + ext)
+		assert.True(t, ok, ext)
+		assert.Equal(t, strings.TrimSuffix(name, "; charset=utf-8"), typ.Name, ext)
+	}
+
+	typ, ok := MimeTypeForFile(`C:\foo\image.JPG`)
+	assert.True(t, ok)
+	assert.Equal(t, "image/jpeg", typ.Name)
+
+	_, ok = MimeTypeForFile("/foo.d/bar")
+	assert.False(t, ok)
+
+	_, ok = MimeTypeForFile("bar")
+	assert.False(t, ok)
+}
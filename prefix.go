@@ -0,0 +1,100 @@
+package serve
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// ParsePrefixes parses a list of IP address ranges in CIDR notation. Entries
+// may be separated by whitespace, commas or new lines and plain addresses are
+// treated as single address ranges. Comments starting with "#" are ignored.
+func ParsePrefixes(str string) ([]netip.Prefix, error) {
+	// prepare list
+	var prefixes []netip.Prefix
+
+	// scan lines
+	scanner := bufio.NewScanner(strings.NewReader(str))
+	for scanner.Scan() {
+		// remove comment
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+
+		// parse entries
+		for _, entry := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}) {
+			prefix, err := ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// ParsePrefix parses a single IP address range in CIDR notation. A plain address
+// is treated as a single address range.
+func ParsePrefix(str string) (netip.Prefix, error) {
+	// parse plain address
+	if !strings.Contains(str, "/") {
+		addr, err := netip.ParseAddr(str)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("serve: invalid prefix %q", str)
+		}
+		addr = normalizeAddr(addr)
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	// parse prefix
+	prefix, err := netip.ParsePrefix(str)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("serve: invalid prefix %q", str)
+	}
+
+	return prefix.Masked(), nil
+}
+
+// LoadPrefixes reads and parses a list of IP address ranges from the specified
+// file using ParsePrefixes.
+func LoadPrefixes(file string) ([]netip.Prefix, error) {
+	// read file
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePrefixes(string(data))
+}
+
+// MustPrefixes will call ParsePrefixes and panic on errors.
+func MustPrefixes(str string) []netip.Prefix {
+	// parse prefixes
+	prefixes, err := ParsePrefixes(str)
+	if err != nil {
+		panic(err)
+	}
+
+	return prefixes
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	// normalize address
+	addr = normalizeAddr(addr)
+
+	// check prefixes
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeAddr(addr netip.Addr) netip.Addr {
+	return addr.Unmap().WithZone("")
+}
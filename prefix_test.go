@@ -0,0 +1,58 @@
+package serve
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes("10.0.0.0/8, 1.2.3.4\n# comment\n 2001:db8::/32 # docs\n::ffff:5.6.7.8\n\n192.168.1.1/16")
+	assert.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("1.2.3.4/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("5.6.7.8/32"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+	}, prefixes)
+
+	prefixes, err = ParsePrefixes("")
+	assert.NoError(t, err)
+	assert.Empty(t, prefixes)
+
+	prefixes, err = ParsePrefixes("10.0.0.0/8 foo")
+	assert.Error(t, err)
+	assert.Equal(t, `serve: invalid prefix "foo"`, err.Error())
+	assert.Nil(t, prefixes)
+
+	assert.Panics(t, func() {
+		MustPrefixes("1.2.3.4/40")
+	})
+}
+
+func TestLoadPrefixes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prefixes.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("10.0.0.0/8\n::1\n"), 0644))
+
+	prefixes, err := LoadPrefixes(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}, prefixes)
+
+	_, err = LoadPrefixes(file + ".missing")
+	assert.Error(t, err)
+}
+
+func TestContainsAddr(t *testing.T) {
+	prefixes := MustPrefixes("10.0.0.0/8, fe80::/10")
+	assert.True(t, containsAddr(prefixes, netip.MustParseAddr("10.1.2.3")))
+	assert.True(t, containsAddr(prefixes, netip.MustParseAddr("::ffff:10.1.2.3")))
+	assert.True(t, containsAddr(prefixes, netip.MustParseAddr("fe80::1%eth0")))
+	assert.False(t, containsAddr(prefixes, netip.MustParseAddr("11.1.2.3")))
+}
@@ -12,6 +12,12 @@ import (
 // remote IP address. It will allow up to the specified rate of requests per
 // duration.
 func Protect(rate int, duration time.Duration) func(http.Handler) http.Handler {
+	return ProtectWith(rate, duration, nil)
+}
+
+// ProtectWith works like Protect but determines the client IP address using the
+// provided resolver. See ClientIP for details.
+func ProtectWith(rate int, duration time.Duration, resolver IPResolver) func(http.Handler) http.Handler {
 	// prepare store
 	store, err := memstore.New(int(MustByteSize("100K")))
 	if err != nil {
@@ -32,7 +38,13 @@ func Protect(rate int, duration time.Duration) func(http.Handler) http.Handler {
 		RateLimiter: rateLimiter,
 		VaryBy: &throttled.VaryBy{
 			Custom: func(r *http.Request) string {
-				return IP(r.RemoteAddr)
+				// resolve address
+				addr := ClientIP(r, resolver)
+				if !addr.IsValid() {
+					return IP(r.RemoteAddr)
+				}
+
+				return addr.String()
 			},
 		},
 		DeniedHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -25,3 +25,23 @@ func TestProtect(t *testing.T) {
 		}
 	}
 }
+
+func TestProtectWith(t *testing.T) {
+	handler := Compose(
+		ProtectWith(1, time.Second, RealIPResolver(nil)),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	for i, ip := range []string{"1.2.3.4", "::ffff:1.2.3.4", "::ffff:1.2.3.4", "1.2.3.5"} {
+		r := Record(nil, handler, "GET", "http://example.com", map[string]string{
+			"X-Real-IP": ip,
+		}, "")
+		if i != 2 {
+			assert.Equal(t, http.StatusOK, r.Code, i)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, r.Code, i)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidProxyHeader is returned if a PROXY protocol header is missing or
+// malformed.
+var ErrInvalidProxyHeader = errors.New("serve: invalid proxy header")
+
+var proxyV1Prefix = []byte("PROXY ")
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// The PROXY protocol v2 TLV types.
+const (
+	ProxyTypeALPN      byte = 0x01
+	ProxyTypeAuthority byte = 0x02
+	ProxyTypeCRC32C    byte = 0x03
+	ProxyTypeNoop      byte = 0x04
+	ProxyTypeUniqueID  byte = 0x05
+	ProxyTypeSSL       byte = 0x20
+	ProxyTypeNetNS     byte = 0x30
+)
+
+// The PROXY protocol v2 SSL sub TLV types.
+const (
+	proxySubTypeSSLVersion byte = 0x21
+	proxySubTypeSSLCN      byte = 0x22
+	proxySubTypeSSLCipher  byte = 0x23
+	proxySubTypeSSLSigAlg  byte = 0x24
+	proxySubTypeSSLKeyAlg  byte = 0x25
+)
+
+// ProxyConfig defines the handling of PROXY protocol headers.
+type ProxyConfig struct {
+	// The source address ranges that are allowed to send a header. Headers
+	// are not parsed for connections from other sources. If empty, no source
+	// is trusted.
+	TrustedSources []netip.Prefix
+
+	// The timeout for reading the header. Defaults to 5s.
+	Timeout time.Duration
+
+	// Whether connections from trusted sources may omit the header.
+	Optional bool
+}
+
+// ProxyHeader is a parsed PROXY protocol header.
+type ProxyHeader struct {
+	// The protocol version (1 or 2).
+	Version int
+
+	// Whether the connection was established by the proxy itself (e.g. for
+	// health checks). The addresses are not set in this case.
+	Local bool
+
+	// The original source and destination addresses.
+	Source      net.Addr
+	Destination net.Addr
+
+	// The TLV extensions (version 2 only).
+	TLVs []ProxyTLV
+
+	// The parsed SSL extension if available.
+	SSL *ProxySSL
+}
+
+// TLV returns the value of the first TLV extension with the specified type.
+func (h *ProxyHeader) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// ProxyTLV is a PROXY protocol v2 TLV extension.
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxySSL describes the client TLS connection terminated by the proxy.
+type ProxySSL struct {
+	// Whether the client connected over SSL/TLS.
+	SSL bool
+
+	// Whether the client provided a certificate in this connection or session.
+	ClientCertConn bool
+	ClientCertSess bool
+
+	// Whether the client certificate was verified successfully.
+	Verified bool
+
+	// The sub TLV values.
+	Version string
+	CN      string
+	Cipher  string
+	SigAlg  string
+	KeyAlg  string
+}
+
+// ProxyListener wraps the provided listener and parses PROXY protocol v1 and
+// v2 headers sent by a load balancer. The header is read lazily on the first
+// read or address access of an accepted connection so that slow clients do not
+// block the listener. The connection's remote and local addresses reflect the
+// addresses described by the header. It will panic if no trusted sources are
+// configured.
+func ProxyListener(listener net.Listener, config ProxyConfig) net.Listener {
+	// check sources
+	if len(config.TrustedSources) == 0 {
+		panic("serve: missing trusted proxy sources")
+	}
+
+	// set default timeout
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	return &proxyListener{
+		Listener: listener,
+		config:   config,
+	}
+}
+
+type proxyListener struct {
+	net.Listener
+	config ProxyConfig
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	// accept connection
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProxyConn{
+		Conn:   conn,
+		config: l.config,
+		reader: bufio.NewReader(conn),
+	}, nil
+}
+
+// ProxyConn is a connection accepted by a proxy listener.
+type ProxyConn struct {
+	net.Conn
+	config ProxyConfig
+	reader *bufio.Reader
+	once   sync.Once
+	header *ProxyHeader
+	err    error
+}
+
+// Header returns the parsed header. It returns nil if the connection is not
+// from a trusted source or the optional header was omitted.
+func (c *ProxyConn) Header() (*ProxyHeader, error) {
+	// ensure header
+	c.once.Do(c.init)
+
+	return c.header, c.err
+}
+
+// Read implements the net.Conn interface.
+func (c *ProxyConn) Read(b []byte) (int, error) {
+	// ensure header
+	c.once.Do(c.init)
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+// RemoteAddr implements the net.Conn interface.
+func (c *ProxyConn) RemoteAddr() net.Addr {
+	// ensure header
+	c.once.Do(c.init)
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr implements the net.Conn interface.
+func (c *ProxyConn) LocalAddr() net.Addr {
+	// ensure header
+	c.once.Do(c.init)
+	if c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+
+	return c.Conn.LocalAddr()
+}
+
+func (c *ProxyConn) init() {
+	// skip untrusted sources
+	if !c.trusted() {
+		return
+	}
+
+	// set deadline
+	err := c.Conn.SetReadDeadline(time.Now().Add(c.config.Timeout))
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	// read header
+	c.header, c.err = readProxyHeader(c.reader, c.config.Optional)
+
+	// reset deadline
+	err = c.Conn.SetReadDeadline(time.Time{})
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *ProxyConn) trusted() bool {
+	// trust none if no sources are configured
+	if len(c.config.TrustedSources) == 0 {
+		return false
+	}
+
+	// get address
+	var addr netip.Addr
+	switch remote := c.Conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		addr = remote.AddrPort().Addr()
+	default:
+		addrPort, err := netip.ParseAddrPort(remote.String())
+		if err != nil {
+			return false
+		}
+		addr = addrPort.Addr()
+	}
+
+	return containsAddr(c.config.TrustedSources, addr)
+}
+
+type proxyConnKey struct{}
+
+// ProxyConnContext may be used as http.Server.ConnContext to make the PROXY
+// protocol header of a connection available to handlers via ProxyInfo.
+func ProxyConnContext(ctx context.Context, conn net.Conn) context.Context {
+	// check connection
+	pc, ok := conn.(*ProxyConn)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, proxyConnKey{}, pc)
+}
+
+// ProxyInfo returns the PROXY protocol header of the connection that carried
+// the request. It requires http.Server.ConnContext to be set to
+// ProxyConnContext and returns nil if no header is available.
+func ProxyInfo(r *http.Request) *ProxyHeader {
+	// get connection
+	pc, ok := r.Context().Value(proxyConnKey{}).(*ProxyConn)
+	if !ok {
+		return nil
+	}
+
+	// get header
+	header, _ := pc.Header()
+
+	return header
+}
+
+func readProxyHeader(r *bufio.Reader, optional bool) (*ProxyHeader, error) {
+	// peek first byte
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	// detect version
+	switch {
+	case first[0] == proxyV1Prefix[0]:
+		if prefix, err := r.Peek(len(proxyV1Prefix)); err == nil && bytes.Equal(prefix, proxyV1Prefix) {
+			return readProxyV1(r)
+		}
+	case first[0] == proxyV2Signature[0]:
+		if signature, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(signature, proxyV2Signature) {
+			return readProxyV2(r)
+		}
+	}
+
+	// handle missing header
+	if optional {
+		return nil, nil
+	}
+
+	return nil, ErrInvalidProxyHeader
+}
+
+func readProxyV1(r *bufio.Reader) (*ProxyHeader, error) {
+	// read line, the maximum length is 107 bytes
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		} else if len(line) >= 107 {
+			return nil, ErrInvalidProxyHeader
+		}
+	}
+
+	// check ending
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// split fields
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+
+	// handle unknown protocol
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &ProxyHeader{Version: 1, Local: true}, nil
+	}
+
+	// check fields
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// parse addresses
+	source, err := parseProxyAddr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	destination, err := parseProxyAddr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProxyHeader{
+		Version:     1,
+		Source:      net.TCPAddrFromAddrPort(source),
+		Destination: net.TCPAddrFromAddrPort(destination),
+	}, nil
+}
+
+func parseProxyAddr(ip, port string, v4 bool) (netip.AddrPort, error) {
+	// parse ip
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != v4 || addr.Zone() != "" {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+
+	// parse port
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+
+	return netip.AddrPortFrom(addr, uint16(n)), nil
+}
+
+func readProxyV2(r *bufio.Reader) (*ProxyHeader, error) {
+	// read fixed header
+	var fixed [16]byte
+	_, err := io.ReadFull(r, fixed[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// check version
+	if fixed[12]>>4 != 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// read payload
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare header
+	header := &ProxyHeader{
+		Version: 2,
+	}
+
+	// check command
+	switch fixed[12] & 0x0F {
+	case 0x0:
+		header.Local = true
+	case 0x1:
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// parse addresses
+	var rest []byte
+	family, protocol := fixed[13]>>4, fixed[13]&0x0F
+	switch family {
+	case 0x0:
+		rest = payload
+	case 0x1, 0x2:
+		// get size
+		size := 4
+		if family == 0x2 {
+			size = 16
+		}
+		if len(payload) < size*2+4 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		// get addresses
+		src, _ := netip.AddrFromSlice(payload[:size])
+		dst, _ := netip.AddrFromSlice(payload[size : size*2])
+		srcPort := binary.BigEndian.Uint16(payload[size*2:])
+		dstPort := binary.BigEndian.Uint16(payload[size*2+2:])
+		rest = payload[size*2+4:]
+
+		// set addresses
+		if !header.Local {
+			switch protocol {
+			case 0x1:
+				header.Source = net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, srcPort))
+				header.Destination = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, dstPort))
+			case 0x2:
+				header.Source = net.UDPAddrFromAddrPort(netip.AddrPortFrom(src, srcPort))
+				header.Destination = net.UDPAddrFromAddrPort(netip.AddrPortFrom(dst, dstPort))
+			default:
+				return nil, ErrInvalidProxyHeader
+			}
+		}
+	case 0x3:
+		// check size
+		if len(payload) < 216 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		// set addresses
+		if !header.Local {
+			network := "unix"
+			if protocol == 0x2 {
+				network = "unixgram"
+			}
+			header.Source = &net.UnixAddr{Net: network, Name: string(bytes.TrimRight(payload[:108], "\x00"))}
+			header.Destination = &net.UnixAddr{Net: network, Name: string(bytes.TrimRight(payload[108:216], "\x00"))}
+		}
+		rest = payload[216:]
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// parse TLVs
+	header.TLVs, err = parseProxyTLVs(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	// parse SSL extension
+	if value, ok := header.TLV(ProxyTypeSSL); ok {
+		header.SSL, err = parseProxySSL(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return header, nil
+}
+
+func parseProxyTLVs(data []byte) ([]ProxyTLV, error) {
+	// parse TLVs
+	var tlvs []ProxyTLV
+	for len(data) > 0 {
+		// check size
+		if len(data) < 3 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		// get length
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+length {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		// add TLV
+		tlvs = append(tlvs, ProxyTLV{
+			Type:  data[0],
+			Value: data[3 : 3+length],
+		})
+
+		// advance
+		data = data[3+length:]
+	}
+
+	return tlvs, nil
+}
+
+func parseProxySSL(data []byte) (*ProxySSL, error) {
+	// check size
+	if len(data) < 5 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	// prepare info
+	ssl := &ProxySSL{
+		SSL:            data[0]&0x01 != 0,
+		ClientCertConn: data[0]&0x02 != 0,
+		ClientCertSess: data[0]&0x04 != 0,
+		Verified:       binary.BigEndian.Uint32(data[1:5]) == 0,
+	}
+
+	// parse sub TLVs
+	tlvs, err := parseProxyTLVs(data[5:])
+	if err != nil {
+		return nil, err
+	}
+
+	// set values
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case proxySubTypeSSLVersion:
+			ssl.Version = string(tlv.Value)
+		case proxySubTypeSSLCN:
+			ssl.CN = string(tlv.Value)
+		case proxySubTypeSSLCipher:
+			ssl.Cipher = string(tlv.Value)
+		case proxySubTypeSSLSigAlg:
+			ssl.SigAlg = string(tlv.Value)
+		case proxySubTypeSSLKeyAlg:
+			ssl.KeyAlg = string(tlv.Value)
+		}
+	}
+
+	return ssl, nil
+}
@@ -0,0 +1,228 @@
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadProxyHeaderV1(t *testing.T) {
+	header, err := readProxyHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 1.2.3.4 5.6.7.8 1234 443\r\nGET /")), false)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProxyHeader{
+		Version:     1,
+		Source:      net.TCPAddrFromAddrPort(netip.MustParseAddrPort("1.2.3.4:1234")),
+		Destination: net.TCPAddrFromAddrPort(netip.MustParseAddrPort("5.6.7.8:443")),
+	}, header)
+
+	header, err = readProxyHeader(bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 2001:db8::2 1234 443\r\n")), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:1234", header.Source.String())
+	assert.Equal(t, "[2001:db8::2]:443", header.Destination.String())
+
+	header, err = readProxyHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")), false)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProxyHeader{Version: 1, Local: true}, header)
+
+	for _, str := range []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 1.2.3.4 5.6.7.8 1234\r\n",
+		"PROXY TCP4 2001:db8::1 5.6.7.8 1234 443\r\n",
+		"PROXY TCP4 1.2.3.4 5.6.7.8 1234 99999\r\n",
+		"PROXY TCP4 1.2.3.4 5.6.7.8 01234 443\r\n",
+		"PROXY TCP4 1.2.3.4 5.6.7.8 1234 443\n",
+		"PROXY " + strings.Repeat("x", 120) + "\r\n",
+		"PROXY TCP4 1.2.3.4",
+	} {
+		_, err = readProxyHeader(bufio.NewReader(strings.NewReader(str)), false)
+		assert.Error(t, err, str)
+	}
+
+	header, err = readProxyHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n")), true)
+	assert.NoError(t, err)
+	assert.Nil(t, header)
+}
+
+func TestReadProxyHeaderV2(t *testing.T) {
+	ssl := append([]byte{0x07, 0, 0, 0, 0}, proxyTLV(proxySubTypeSSLVersion, "TLSv1.3")...)
+	ssl = append(ssl, proxyTLV(proxySubTypeSSLCN, "client")...)
+	ssl = append(ssl, proxyTLV(proxySubTypeSSLCipher, "TLS_AES_128_GCM_SHA256")...)
+
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8, 0x04, 0xD2, 0x01, 0xBB}
+	payload = append(payload, proxyTLV(ProxyTypeAuthority, "example.com")...)
+	payload = append(payload, proxyTLV(ProxyTypeSSL, string(ssl))...)
+
+	header, err := readProxyHeader(bufio.NewReader(bytes.NewReader(proxyV2(0x21, 0x11, payload))), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, header.Version)
+	assert.False(t, header.Local)
+	assert.Equal(t, "1.2.3.4:1234", header.Source.String())
+	assert.Equal(t, "5.6.7.8:443", header.Destination.String())
+	assert.Len(t, header.TLVs, 2)
+
+	authority, ok := header.TLV(ProxyTypeAuthority)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", string(authority))
+
+	_, ok = header.TLV(ProxyTypeALPN)
+	assert.False(t, ok)
+
+	assert.Equal(t, &ProxySSL{
+		SSL:            true,
+		ClientCertConn: true,
+		ClientCertSess: true,
+		Verified:       true,
+		Version:        "TLSv1.3",
+		CN:             "client",
+		Cipher:         "TLS_AES_128_GCM_SHA256",
+	}, header.SSL)
+
+	payload = make([]byte, 36)
+	copy(payload, netip.MustParseAddr("2001:db8::1").AsSlice())
+	copy(payload[16:], netip.MustParseAddr("2001:db8::2").AsSlice())
+	binary.BigEndian.PutUint16(payload[32:], 1234)
+	binary.BigEndian.PutUint16(payload[34:], 53)
+
+	header, err = readProxyHeader(bufio.NewReader(bytes.NewReader(proxyV2(0x21, 0x22, payload))), false)
+	assert.NoError(t, err)
+	assert.Equal(t, &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}, header.Source)
+
+	header, err = readProxyHeader(bufio.NewReader(bytes.NewReader(proxyV2(0x20, 0x00, nil))), false)
+	assert.NoError(t, err)
+	assert.Equal(t, &ProxyHeader{Version: 2, Local: true}, header)
+
+	for _, data := range [][]byte{
+		proxyV2(0x11, 0x11, make([]byte, 12)),
+		proxyV2(0x22, 0x11, make([]byte, 12)),
+		proxyV2(0x21, 0x11, make([]byte, 8)),
+		proxyV2(0x21, 0x41, make([]byte, 12)),
+		proxyV2(0x21, 0x11, append(make([]byte, 12), 0x01, 0x00)),
+		proxyV2(0x21, 0x11, append(make([]byte, 12), 0x01, 0x00, 0x05, 0x01)),
+		proxyV2(0x21, 0x11, make([]byte, 12))[:20],
+	} {
+		_, err = readProxyHeader(bufio.NewReader(bytes.NewReader(data)), false)
+		assert.Error(t, err)
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var authority string
+			if info := ProxyInfo(r); info != nil {
+				value, _ := info.TLV(ProxyTypeAuthority)
+				authority = string(value)
+			}
+			_, _ = w.Write([]byte(r.RemoteAddr + " " + authority))
+		}),
+		ConnContext: ProxyConnContext,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = server.Serve(ProxyListener(listener, ProxyConfig{
+			TrustedSources: LoopbackProxies(),
+			Timeout:        50 * time.Millisecond,
+			Optional:       true,
+		}))
+		close(done)
+	}()
+
+	request := func(header []byte) string {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write(append(header, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"...))
+		assert.NoError(t, err)
+
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return err.Error()
+		}
+		body, _ := io.ReadAll(res.Body)
+		return string(body)
+	}
+
+	assert.Equal(t, "1.2.3.4:1234 ", request([]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1234 443\r\n")))
+
+	payload := append([]byte{1, 2, 3, 4, 5, 6, 7, 8, 0x04, 0xD2, 0x01, 0xBB}, proxyTLV(ProxyTypeAuthority, "example.com")...)
+	assert.Equal(t, "1.2.3.4:1234 example.com", request(proxyV2(0x21, 0x11, payload)))
+
+	assert.True(t, strings.HasPrefix(request(nil), "127.0.0.1:"))
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("PROXY TCP4"))
+	assert.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	_ = conn.Close()
+
+	assert.NoError(t, server.Close())
+	<-done
+}
+
+func TestProxyListenerUntrusted(t *testing.T) {
+	for _, sources := range [][]netip.Prefix{nil, MustPrefixes("10.0.0.0/8")} {
+		testProxyListenerUntrusted(t, sources)
+	}
+
+	assert.PanicsWithValue(t, "serve: missing trusted proxy sources", func() {
+		ProxyListener(nil, ProxyConfig{})
+	})
+}
+
+func testProxyListenerUntrusted(t *testing.T, sources []netip.Prefix) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := &ProxyConn{
+		Conn: server,
+		config: ProxyConfig{
+			TrustedSources: sources,
+		},
+		reader: bufio.NewReader(server),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1234 443\r\n"))
+		close(done)
+	}()
+
+	header, err := conn.Header()
+	assert.NoError(t, err)
+	assert.Nil(t, header)
+	assert.Equal(t, "pipe", conn.RemoteAddr().String())
+
+	buf := make([]byte, 6)
+	_, err = io.ReadFull(conn, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "PROXY ", string(buf))
+
+	<-done
+}
+
+func proxyV2(verCmd, family byte, payload []byte) []byte {
+	data := append([]byte{}, proxyV2Signature...)
+	data = append(data, verCmd, family, 0, 0)
+	binary.BigEndian.PutUint16(data[14:], uint16(len(payload)))
+	return append(data, payload...)
+}
+
+func proxyTLV(typ byte, value string) []byte {
+	return append([]byte{typ, byte(len(value) >> 8), byte(len(value))}, value...)
+}
@@ -28,6 +28,12 @@ func Secure(w http.ResponseWriter, r *http.Request, allowInsecure, noFrontend bo
 		url := *r.URL
 		url.Host = r.Host
 		url.Scheme = "https"
+		if prefix := ForwardedPrefix(r); prefix != "" {
+			url.Path = prefix + url.Path
+			if url.RawPath != "" {
+				url.RawPath = prefix + url.RawPath
+			}
+		}
 		http.Redirect(w, r, url.String(), http.StatusMovedPermanently)
 		return false
 	}
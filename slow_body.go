@@ -0,0 +1,186 @@
+package serve
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrBodyTooSlow is returned if a body is read slower than allowed.
+var ErrBodyTooSlow = errors.New("body too slow")
+
+// SlowBodyConfig defines the minimum transfer rate and idle timeout for request
+// bodies.
+//
+// MinRate is the minimum average rate in bytes per second that is enforced
+// after the initial GracePeriod (defaults to five seconds). IdleTimeout is the
+// maximum time a single read may block.
+type SlowBodyConfig struct {
+	MinRate     int64
+	GracePeriod time.Duration
+	IdleTimeout time.Duration
+}
+
+// SlowBody will return a middleware that guards the request body against slow
+// clients. If supported by the connection, read deadlines are set using
+// http.ResponseController to interrupt blocked reads. Reads that violate the
+// configured rate or timeout return ErrBodyTooSlow. If the handler does not
+// write a response in that case, a "408 Request Timeout" response is written
+// and the connection is closed.
+func SlowBody(config SlowBodyConfig) func(http.Handler) http.Handler {
+	// set default grace period
+	if config.GracePeriod == 0 {
+		config.GracePeriod = 5 * time.Second
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// skip if there is no body
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// guard body
+			guard := &SlowBodyGuard{
+				MinRate:     config.MinRate,
+				GracePeriod: config.GracePeriod,
+				IdleTimeout: config.IdleTimeout,
+				Original:    r.Body,
+				Controller:  http.NewResponseController(w),
+				Start:       time.Now(),
+			}
+			r.Body = guard
+
+			// call next
+			lw := &limitWriter{ResponseWriter: w}
+			next.ServeHTTP(lw, r)
+
+			// clear or expire deadline
+			guard.clear()
+
+			// respond if the body was too slow without a response
+			if guard.Slow && !lw.written {
+				w.Header().Set("Connection", "close")
+				w.WriteHeader(http.StatusRequestTimeout)
+			}
+		})
+	}
+}
+
+// SlowBodyGuard wraps an io.ReadCloser and enforces a minimum transfer rate
+// and idle timeout. Slow is set when ErrBodyTooSlow has been returned.
+type SlowBodyGuard struct {
+	MinRate     int64
+	GracePeriod time.Duration
+	IdleTimeout time.Duration
+	Original    io.ReadCloser
+	Controller  *http.ResponseController
+	Start       time.Time
+	Bytes       int64
+	Slow        bool
+
+	deadline bool
+}
+
+// Read will read from the underlying io.Reader.
+func (g *SlowBodyGuard) Read(p []byte) (int, error) {
+	// fail immediately if already too slow
+	if g.Slow {
+		return 0, ErrBodyTooSlow
+	}
+
+	// set deadline
+	if deadline := g.next(time.Now()); !deadline.IsZero() && g.Controller != nil {
+		if g.Controller.SetReadDeadline(deadline) == nil {
+			g.deadline = true
+		}
+	}
+
+	// read
+	start := time.Now()
+	n, err := g.Original.Read(p)
+	g.Bytes += int64(n)
+
+	// check timeouts
+	var netErr net.Error
+	if errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		g.Slow = true
+		return n, ErrBodyTooSlow
+	}
+
+	// check rate and idle time for connections without deadlines
+	now := time.Now()
+	if err == nil && g.tooSlow(start, now) {
+		g.Slow = true
+		return n, ErrBodyTooSlow
+	}
+
+	// clear deadline when done
+	if err != nil {
+		g.clear()
+	}
+
+	return n, err
+}
+
+// Close will close the body.
+func (g *SlowBodyGuard) Close() error {
+	return g.Original.Close()
+}
+
+func (g *SlowBodyGuard) next(now time.Time) time.Time {
+	// prepare deadline
+	var deadline time.Time
+
+	// apply idle timeout
+	if g.IdleTimeout > 0 {
+		deadline = now.Add(g.IdleTimeout)
+	}
+
+	// apply rate, the next byte must arrive before the average rate drops
+	// below the minimum
+	if g.MinRate > 0 {
+		rate := g.Start.Add(g.GracePeriod + time.Duration(float64(g.Bytes+1)/float64(g.MinRate)*float64(time.Second)))
+		if deadline.IsZero() || rate.Before(deadline) {
+			deadline = rate
+		}
+	}
+
+	return deadline
+}
+
+func (g *SlowBodyGuard) tooSlow(start, now time.Time) bool {
+	// check idle timeout
+	if g.IdleTimeout > 0 && now.Sub(start) > g.IdleTimeout {
+		return true
+	}
+
+	// check rate
+	if g.MinRate > 0 {
+		allowed := g.GracePeriod + time.Duration(float64(g.Bytes)/float64(g.MinRate)*float64(time.Second))
+		if now.Sub(g.Start) > allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *SlowBodyGuard) clear() {
+	// expire deadline if too slow to abort draining the remaining body
+	if g.Slow && g.Controller != nil {
+		_ = g.Controller.SetReadDeadline(time.Now())
+		g.deadline = false
+		return
+	}
+
+	// clear deadline if set
+	if g.deadline {
+		_ = g.Controller.SetReadDeadline(time.Time{})
+		g.deadline = false
+	}
+}
@@ -0,0 +1,88 @@
+package serve
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type slowReader struct {
+	data  string
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func TestSlowBody(t *testing.T) {
+	var errs []error
+	handler := Compose(
+		SlowBody(SlowBodyConfig{
+			MinRate:     1000,
+			GracePeriod: 10 * time.Millisecond,
+			IdleTimeout: 20 * time.Millisecond,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := io.ReadAll(r.Body)
+			errs = append(errs, err)
+		}),
+	)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("Hello World!"))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	req = httptest.NewRequest("POST", "/", &slowReader{data: "Hello World!", delay: 5 * time.Millisecond})
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusRequestTimeout, res.Code)
+	assert.Equal(t, "close", res.Header().Get("Connection"))
+	assert.True(t, req.Body.(*SlowBodyGuard).Slow)
+
+	req = httptest.NewRequest("POST", "/", &slowReader{data: "Hello", delay: 30 * time.Millisecond})
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusRequestTimeout, res.Code)
+
+	assert.Equal(t, []error{nil, ErrBodyTooSlow, ErrBodyTooSlow}, errs)
+}
+
+func TestSlowBodyDeadline(t *testing.T) {
+	errs := make(chan error, 1)
+	server := httptest.NewServer(Compose(
+		SlowBody(SlowBodyConfig{
+			IdleTimeout: 50 * time.Millisecond,
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := io.ReadAll(r.Body)
+			errs <- err
+		}),
+	))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 100\r\n\r\nHello"))
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 408 Request Timeout\r\n"), string(data))
+	assert.Equal(t, ErrBodyTooSlow, <-errs)
+}